@@ -2,9 +2,11 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"os/signal"
 	"syscall"
 	"time"
@@ -29,6 +31,11 @@ func gracefulShutdown(apiServer *http.Server, done chan bool) {
 	defer cancel()
 	if err := apiServer.Shutdown(ctx); err != nil {
 		log.Printf("Server forced to shutdown with error: %v", err)
+		// Closing the server cancels the contexts of the requests still
+		// running, which aborts their database calls.
+		if err := apiServer.Close(); err != nil {
+			log.Printf("Failed to close server: %v", err)
+		}
 	}
 
 	log.Println("Server exiting")
@@ -38,6 +45,20 @@ func gracefulShutdown(apiServer *http.Server, done chan bool) {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	migrate := flag.Bool("migrate", false, "apply the pending database migrations before starting the server")
+	flag.Parse()
+	if *migrate {
+		if err := migrateOnStart(); err != nil {
+			log.Fatalf("Failed to migrate the database: %v", err)
+		}
+	}
 
 	server := server.NewServer()
 
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"go-todo/internal/database"
+)
+
+const migrateUsage = `usage: api migrate <command>
+
+Commands:
+  up         apply all pending migrations
+  down [N]   roll back the last N migrations (default 1), or all of
+             them if N is "all"
+  version    print the version of the last migration applied
+  force V    set the version to V without migrating, after fixing
+             the schema by hand when a migration failed`
+
+// runMigrate runs the migrate subcommand given by args.
+func runMigrate(args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+	if !hasMigrations() {
+		return fmt.Errorf("DB_DRIVER %s has no migrations; it creates its tables itself", os.Getenv("DB_DRIVER"))
+	}
+
+	command, args := args[0], args[1:]
+	var steps, version int
+	switch {
+	case command == "up" && len(args) == 0, command == "version" && len(args) == 0:
+	case command == "down" && len(args) == 0:
+		steps = 1
+	case command == "down" && len(args) == 1 && args[0] == "all":
+		steps = -1 // every migration
+	case command == "down" && len(args) == 1:
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid number of migrations %q", args[0])
+		}
+		steps = n
+	case command == "force" && len(args) == 1:
+		v, err := strconv.Atoi(args[0])
+		if err != nil || v < -1 {
+			return fmt.Errorf("invalid version %q", args[0])
+		}
+		version = v
+	default:
+		return errors.New(migrateUsage)
+	}
+
+	m, err := database.NewMigrator()
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	switch command {
+	case "up":
+		err = m.Up()
+	case "down":
+		if steps < 0 {
+			err = m.DownAll()
+		} else {
+			err = m.Down(steps)
+		}
+	case "force":
+		err = m.Force(version)
+	}
+	if err != nil {
+		return err
+	}
+	return printVersion(m)
+}
+
+// migrateOnStart applies the pending migrations before the server starts.
+func migrateOnStart() error {
+	if !hasMigrations() {
+		log.Printf("DB_DRIVER %s has no migrations, skipping them", os.Getenv("DB_DRIVER"))
+		return nil
+	}
+
+	m, err := database.NewMigrator()
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	if err := m.Up(); err != nil {
+		return err
+	}
+	return printVersion(m)
+}
+
+func printVersion(m *database.Migrator) error {
+	version, dirty, err := m.Version()
+	if err != nil {
+		return err
+	}
+	if dirty {
+		log.Printf("Database schema at version %d (dirty)", version)
+	} else {
+		log.Printf("Database schema at version %d", version)
+	}
+	return nil
+}
+
+// hasMigrations reports whether DB_DRIVER selects a database with migrations:
+// Postgres or an SQLite file, but not the in-memory store.
+func hasMigrations() bool {
+	return os.Getenv("DB_DRIVER") != "memory"
+}
@@ -0,0 +1,32 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// ArchiveCompletedTodos archives the todos that were completed before the
+// given time and returns how many it archived. Archived todos are left out of
+// listings unless TodoFilter.Archived asks for them, and are unarchived again
+// when they are reopened.
+func (s *dbService) ArchiveCompletedTodos(ctx context.Context, before time.Time) (int64, error) {
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx,
+		"UPDATE todos SET archived_at = $1 "+
+			"WHERE completed AND completed_at < $2 AND archived_at IS NULL AND deleted_at IS NULL",
+		time.Now(), before,
+	)
+	if err != nil {
+		return 0, err
+	}
+	archived, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return archived, tx.Commit()
+}
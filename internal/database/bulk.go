@@ -0,0 +1,159 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-todo/internal/models"
+)
+
+// TodoOperationKind names the write performed by a TodoOperation.
+type TodoOperationKind string
+
+const (
+	OperationCreate TodoOperationKind = "create"
+	OperationPatch  TodoOperationKind = "patch"
+	OperationDelete TodoOperationKind = "delete"
+)
+
+// TodoOperation is one write of a batch passed to ApplyTodoOperations.
+type TodoOperation struct {
+	Kind TodoOperationKind
+	// Todo is the todo to create or patch. Deletions only use its ID and,
+	// if it is not zero, its Version.
+	Todo models.Todo
+	// Fields lists the fields written by a patch, as for PatchTodo.
+	Fields []string
+	// CompleteSubtasks completes the open descendants of a patched todo.
+	CompleteSubtasks bool
+	// Next is created together with a patch as the next occurrence of a
+	// recurring todo that is being completed.
+	Next *models.Todo
+}
+
+// TodoOperationResult is the outcome of a TodoOperation.
+type TodoOperationResult struct {
+	// Todo is the created or patched todo.
+	Todo models.Todo
+	// Next is the created next occurrence, if any.
+	Next *models.Todo
+	Err  error
+}
+
+// ErrRolledBack is reported for the operations of an atomic batch that were
+// not applied because another operation of the batch failed.
+var ErrRolledBack = errors.New("database: operation rolled back")
+
+// ApplyTodoOperations runs ops in order in a single transaction and reports
+// the outcome of each. An atomic batch is rolled back as a whole as soon as an
+// operation fails, and every other operation reports ErrRolledBack. Otherwise
+// a failed operation is undone on its own and the others are committed. The
+// returned error is only set if the transaction itself failed.
+func (s *dbService) ApplyTodoOperations(ctx context.Context, ops []TodoOperation, atomic bool) ([]TodoOperationResult, error) {
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	results := make([]TodoOperationResult, len(ops))
+	for i, op := range ops {
+		if !atomic {
+			if _, err := tx.ExecContext(ctx, "SAVEPOINT todo_operation"); err != nil {
+				return nil, err
+			}
+		}
+		result, err := applyTodoOperation(ctx, tx, op)
+		if err == nil {
+			results[i] = result
+			if !atomic {
+				if _, err := tx.ExecContext(ctx, "RELEASE SAVEPOINT todo_operation"); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+
+		if atomic {
+			for j := range results {
+				results[j] = TodoOperationResult{Err: ErrRolledBack}
+			}
+			results[i].Err = err
+			return results, nil
+		}
+		results[i].Err = err
+		if _, err := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT todo_operation"); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	var todos []models.Todo
+	for _, result := range results {
+		if result.Err == nil && result.Todo.ID != 0 {
+			todos = append(todos, result.Todo)
+		}
+	}
+	if err := s.loadRelations(ctx, todos); err != nil {
+		return nil, err
+	}
+	for i, j := 0, 0; i < len(results); i++ {
+		if results[i].Err == nil && results[i].Todo.ID != 0 {
+			results[i].Todo = todos[j]
+			j++
+		}
+	}
+	return results, nil
+}
+
+func applyTodoOperation(ctx context.Context, tx queryer, op TodoOperation) (TodoOperationResult, error) {
+	switch op.Kind {
+	case OperationCreate:
+		todo := op.Todo
+		err := createTodo(ctx, tx, &todo)
+		return TodoOperationResult{Todo: todo}, err
+
+	case OperationPatch:
+		todo, err := patchTodo(ctx, tx, &op.Todo, op.Fields)
+		if err != nil {
+			return TodoOperationResult{}, err
+		}
+		if op.CompleteSubtasks {
+			if err := completeDescendants(ctx, tx, todo.ID); err != nil {
+				return TodoOperationResult{}, err
+			}
+		}
+		if op.Next != nil {
+			next := *op.Next
+			if err := createTodo(ctx, tx, &next); err != nil {
+				return TodoOperationResult{}, err
+			}
+			return TodoOperationResult{Todo: todo, Next: &next}, nil
+		}
+		return TodoOperationResult{Todo: todo}, nil
+
+	case OperationDelete:
+		return TodoOperationResult{}, deleteTodo(ctx, tx, op.Todo.ID, op.Todo.Version)
+	}
+	return TodoOperationResult{}, fmt.Errorf("database: unknown todo operation %q", op.Kind)
+}
+
+// deleteTodo moves the todo with the given id and its subtasks to the trash
+// within tx, provided it still has the given version unless that is zero.
+func deleteTodo(ctx context.Context, tx queryer, id, version int) error {
+	var b queryBuilder
+	cond := "id = " + b.arg(id)
+	if version != 0 {
+		cond += " AND version = " + b.arg(version)
+	}
+	trashed, err := trashTodos(ctx, tx, cond, b.args...)
+	if err != nil {
+		return err
+	}
+	if trashed == 0 {
+		return versionError(ctx, tx, id)
+	}
+	return nil
+}
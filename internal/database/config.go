@@ -0,0 +1,99 @@
+package database
+
+import (
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Default settings of the Postgres connection pool unless DB_MAX_OPEN_CONNS,
+// DB_MAX_IDLE_CONNS or DB_CONN_MAX_LIFETIME say otherwise.
+const (
+	defaultMaxOpenConns    = 25
+	defaultMaxIdleConns    = 10
+	defaultConnMaxLifetime = 30 * time.Minute
+)
+
+// Config describes the Postgres database to connect to and the pool of
+// connections kept to it.
+type Config struct {
+	// URL is a complete connection string. If it is set, the fields that
+	// make one up are ignored.
+	URL string
+
+	Host     string
+	Port     string
+	Database string
+	Username string
+	Password string
+	Schema   string
+	SSLMode  string
+
+	// MaxOpenConns limits the connections open at once; 0 means no limit.
+	MaxOpenConns int
+	// MaxIdleConns limits the connections kept open while unused.
+	MaxIdleConns int
+	// ConnMaxLifetime is how long a connection is reused before it is
+	// closed; 0 means forever.
+	ConnMaxLifetime time.Duration
+}
+
+// ConfigFromEnv returns the Config given by the environment: DATABASE_URL or
+// DB_HOST, DB_PORT, DB_DATABASE, DB_USERNAME, DB_PASSWORD, DB_SCHEMA and
+// DB_SSLMODE, along with the pool settings.
+func ConfigFromEnv() Config {
+	return Config{
+		URL:             os.Getenv("DATABASE_URL"),
+		Host:            os.Getenv("DB_HOST"),
+		Port:            os.Getenv("DB_PORT"),
+		Database:        os.Getenv("DB_DATABASE"),
+		Username:        os.Getenv("DB_USERNAME"),
+		Password:        os.Getenv("DB_PASSWORD"),
+		Schema:          os.Getenv("DB_SCHEMA"),
+		SSLMode:         os.Getenv("DB_SSLMODE"),
+		MaxOpenConns:    parseConns("DB_MAX_OPEN_CONNS", os.Getenv("DB_MAX_OPEN_CONNS"), defaultMaxOpenConns),
+		MaxIdleConns:    parseConns("DB_MAX_IDLE_CONNS", os.Getenv("DB_MAX_IDLE_CONNS"), defaultMaxIdleConns),
+		ConnMaxLifetime: parseTimeout("DB_CONN_MAX_LIFETIME", os.Getenv("DB_CONN_MAX_LIFETIME"), defaultConnMaxLifetime),
+	}
+}
+
+// DSN returns the connection string, escaping the fields that make it up so
+// that passwords and names may contain any character.
+func (c Config) DSN() string {
+	if c.URL != "" {
+		return c.URL
+	}
+
+	dsn := url.URL{Scheme: "postgres", Host: c.Host, Path: "/" + c.Database}
+	if c.Port != "" {
+		dsn.Host = net.JoinHostPort(c.Host, c.Port)
+	}
+	if c.Username != "" || c.Password != "" {
+		dsn.User = url.UserPassword(c.Username, c.Password)
+	}
+	// sslmode is passed even when it is empty, which pgx reads as prefer,
+	// so that PGSSLMODE does not override DB_SSLMODE.
+	query := url.Values{"sslmode": {c.SSLMode}}
+	if c.Schema != "" {
+		query.Set("search_path", c.Schema)
+	}
+	dsn.RawQuery = query.Encode()
+	return dsn.String()
+}
+
+// parseConns returns the number of connections given by the environment
+// variable name, or fallback if it is unset or invalid.
+func parseConns(name, value string, fallback int) int {
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		log.Printf("invalid %s %q, falling back to %d", name, value, fallback)
+		return fallback
+	}
+	return n
+}
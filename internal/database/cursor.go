@@ -0,0 +1,135 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"go-todo/internal/models"
+	"strings"
+	"time"
+)
+
+// todoCursor identifies the last todo of a page. It records the sort order it
+// was created for, so it cannot be replayed against a differently sorted list.
+type todoCursor struct {
+	Sort   string            `json:"s"`
+	Values []json.RawMessage `json:"v"`
+	ID     int               `json:"id"`
+}
+
+// sortSignature formats keys the way they are given in a ?sort= parameter.
+func sortSignature(keys []SortKey) string {
+	terms := make([]string, len(keys))
+	for i, key := range keys {
+		terms[i] = string(key.Field)
+		if key.Desc {
+			terms[i] = "-" + terms[i]
+		}
+	}
+	return strings.Join(terms, ",")
+}
+
+// encodeCursor returns the opaque cursor pointing just after todo.
+func encodeCursor(todo models.Todo, keys []SortKey) (string, error) {
+	c := todoCursor{Sort: sortSignature(keys), ID: todo.ID}
+	for _, key := range keys {
+		var value any
+		switch key.Field {
+		case SortPriority:
+			value = todo.Priority
+		case SortDueAt:
+			value = todo.DueAt
+		case SortCreatedAt:
+			value = todo.CreatedAt
+		case SortTitle:
+			value = todo.Title
+		}
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return "", err
+		}
+		c.Values = append(c.Values, raw)
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeCursor parses a cursor created by encodeCursor for the same sort keys
+// and returns the sort values it holds. It returns ErrInvalidCursor if the
+// cursor is malformed or belongs to another sort order.
+func decodeCursor(s string, keys []SortKey) (todoCursor, []any, error) {
+	var c todoCursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || json.Unmarshal(data, &c) != nil {
+		return c, nil, ErrInvalidCursor
+	}
+	if c.Sort != sortSignature(keys) || len(c.Values) != len(keys) {
+		return c, nil, ErrInvalidCursor
+	}
+
+	values := make([]any, len(keys))
+	for i, key := range keys {
+		var err error
+		switch key.Field {
+		case SortPriority:
+			var priority int
+			err = json.Unmarshal(c.Values[i], &priority)
+			values[i] = priority
+		case SortDueAt:
+			var dueAt *time.Time
+			err = json.Unmarshal(c.Values[i], &dueAt)
+			values[i] = dueAt
+		case SortCreatedAt:
+			var createdAt time.Time
+			err = json.Unmarshal(c.Values[i], &createdAt)
+			values[i] = createdAt
+		case SortTitle:
+			var title string
+			err = json.Unmarshal(c.Values[i], &title)
+			values[i] = title
+		}
+		if err != nil {
+			return c, nil, ErrInvalidCursor
+		}
+	}
+	return c, values, nil
+}
+
+// after adds the keyset condition selecting the todos that follow the cursor
+// in the order produced by orderClause. For sort keys (k1, k2) this expands to
+//
+//	k1 > v1 OR (k1 = v1 AND k2 > v2) OR (k1 = v1 AND k2 = v2 AND id > last)
+//
+// with the comparisons flipped for descending keys and NULL due dates sorting
+// last in both directions.
+func (c todoCursor) after(b *queryBuilder, keys []SortKey, values []any) {
+	var terms, equal []string
+	for i, key := range keys {
+		column := sortColumns[key.Field]
+		op := " > "
+		if key.Desc {
+			op = " < "
+		}
+
+		if dueAt, ok := values[i].(*time.Time); ok && dueAt == nil {
+			// Nothing sorts after NULL, so only ties can follow.
+			equal = append(equal, column+" IS NULL")
+			continue
+		}
+
+		placeholder := b.arg(values[i])
+		if key.Field == SortTitle {
+			placeholder = "lower(" + placeholder + ")"
+		}
+		greater := column + op + placeholder
+		if key.Field == SortDueAt {
+			greater = "(" + greater + " OR " + column + " IS NULL)"
+		}
+		terms = append(terms, strings.Join(append(equal[:len(equal):len(equal)], greater), " AND "))
+		equal = append(equal, column+" = "+placeholder)
+	}
+	terms = append(terms, strings.Join(append(equal, "id > "+b.arg(c.ID)), " AND "))
+	b.where("((" + strings.Join(terms, ") OR (") + "))")
+}
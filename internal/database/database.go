@@ -3,73 +3,222 @@ package database
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"go-todo/internal/models"
 	"log"
 	"os"
 	"strconv"
+	"sync"
 	"time"
 
+	"github.com/jackc/pgx/v5/pgconn"
 	_ "github.com/jackc/pgx/v5/stdlib"
 	_ "github.com/joho/godotenv/autoload"
+	sqlite3 "modernc.org/sqlite/lib"
 )
 
 // DBService represents a service that interacts with a database.
 type DBService interface {
 	// Health returns a map of health status information.
 	// The keys and values in the map are service-specific.
-	Health() map[string]string
+	Health(ctx context.Context) map[string]string
 
-	// Todos
-	GetTodos() ([]models.Todo, error)
-	GetTodo(id int) (models.Todo, error)
-	CreateTodo(todo *models.Todo) error
-	UpdateTodo(todo *models.Todo) error
-	DeleteTodo(id int) error
+	Store
+
+	// WithTx runs fn in a transaction with the given isolation level. The
+	// changes fn makes through tx take effect together once it returns nil
+	// and are rolled back if it returns an error. If the transaction fails
+	// because of concurrent transactions, it is retried with a new call to
+	// fn, so fn must not have side effects other than through tx.
+	WithTx(ctx context.Context, isolation sql.IsolationLevel, fn func(tx Store) error) error
 
 	// Close terminates the database connection.
 	// It returns an error if the connection cannot be closed.
 	Close() error
 }
 
+// Store reads and writes the records of the application, either directly or
+// within a transaction started by DBService.WithTx.
+type Store interface {
+	// Todos
+	GetTodos(ctx context.Context, filter TodoFilter) ([]models.Todo, error)
+	GetTodoPage(ctx context.Context, filter TodoFilter, limit int, cursor string) (TodoPage, error)
+	SearchTodos(ctx context.Context, search Search, limit int) ([]models.SearchResult, error)
+	GetTodo(ctx context.Context, id int) (models.Todo, error)
+	CreateTodo(ctx context.Context, todo *models.Todo) error
+	UpdateTodo(ctx context.Context, todo *models.Todo) error
+	PatchTodo(ctx context.Context, todo *models.Todo, fields []string) error
+	DeleteTodo(ctx context.Context, id int) error
+	ApplyTodoOperations(ctx context.Context, ops []TodoOperation, atomic bool) ([]TodoOperationResult, error)
+
+	// History
+	GetTodoHistory(ctx context.Context, id int) ([]models.TodoRevision, error)
+	GetTodoRevision(ctx context.Context, id, version int) (models.TodoRevision, error)
+
+	// Archive
+	ArchiveCompletedTodos(ctx context.Context, before time.Time) (int64, error)
+
+	// Trash
+	GetTrash(ctx context.Context) ([]models.Todo, error)
+	RestoreTodo(ctx context.Context, id int) error
+	PurgeTodo(ctx context.Context, id int) error
+	PurgeTrash(ctx context.Context, before time.Time) (int64, error)
+
+	// Subtasks
+	GetTodoTree(ctx context.Context, id int) (models.TodoNode, error)
+	CompleteDescendants(ctx context.Context, id int) error
+
+	// Tags
+	GetTags(ctx context.Context) ([]models.Tag, error)
+	GetTag(ctx context.Context, id int) (models.Tag, error)
+	CreateTag(ctx context.Context, tag *models.Tag) error
+	UpdateTag(ctx context.Context, tag *models.Tag) error
+	DeleteTag(ctx context.Context, id int) error
+
+	// Projects
+	GetProjects(ctx context.Context) ([]models.Project, error)
+	GetProject(ctx context.Context, id int) (models.Project, error)
+	CreateProject(ctx context.Context, project *models.Project) error
+	UpdateProject(ctx context.Context, project *models.Project) error
+	DeleteProject(ctx context.Context, id int, how ProjectDeletion) error
+
+	// Idempotency keys
+	ReserveIdempotencyKey(ctx context.Context, key, requestHash string, ttl time.Duration) (*IdempotencyRecord, error)
+	CompleteIdempotencyKey(ctx context.Context, record IdempotencyRecord) error
+	ReleaseIdempotencyKey(ctx context.Context, key string) error
+}
+
+// ErrConflict is returned when a write would violate a uniqueness constraint.
+var ErrConflict = errors.New("database: conflicting record already exists")
+
+// ErrInvalidReference is returned when a write refers to a record, such as a
+// project, that does not exist.
+var ErrInvalidReference = errors.New("database: referenced record does not exist")
+
+// ErrCycle is returned when a todo would become a subtask of itself.
+var ErrCycle = errors.New("database: todo cannot be its own ancestor")
+
+// ErrVersionMismatch is returned when a todo was modified since the version
+// a write is based on.
+var ErrVersionMismatch = errors.New("database: todo was modified concurrently")
+
+// ErrInvalidCursor is returned when a pagination cursor is malformed or was
+// issued for a different sort order.
+var ErrInvalidCursor = errors.New("database: invalid pagination cursor")
+
+// ErrTxConflict is returned by WithTx when a transaction keeps failing
+// because of concurrent transactions.
+var ErrTxConflict = errors.New("database: transaction conflicts with concurrent transactions")
+
 type dbService struct {
 	db *sql.DB
+	// tx is the transaction of the Store passed to a WithTx callback, which
+	// every call runs in; it is nil otherwise.
+	tx      *sql.Tx
+	dialect dialect
+
+	// maxIdleConns is the limit of idle connections of db, which its
+	// statistics do not include.
+	maxIdleConns int
+	// healthMu guards lastStats, the statistics of db at the previous Health
+	// call, against which the next call measures the pool's activity.
+	healthMu  sync.Mutex
+	lastStats sql.DBStats
 }
 
-var dbInstance *dbService
+// dialect is the flavor of SQL spoken by the database of a dbService. Most
+// statements are written so that both understand them; the few that differ
+// ask the dialect.
+type dialect int
 
+const (
+	dialectPostgres dialect = iota
+	dialectSQLite
+)
+
+// lockRows returns clause, a row locking clause such as FOR UPDATE, for the
+// end of a SELECT. SQLite has no row locks and needs none, since a write
+// transaction holds the lock of the whole database from its start.
+func (d dialect) lockRows(clause string) string {
+	if d == dialectSQLite {
+		return ""
+	}
+	return " " + clause
+}
+
+var dbInstance DBService
+
+// New returns the DBService selected by DB_DRIVER: postgres, the default,
+// connects to the server described by the DB_* variables, sqlite stores the
+// data in the file named by DB_PATH (todo.db by default) and memory keeps it
+// in memory only. Calls to it time out after DB_READ_TIMEOUT for reads and
+// DB_WRITE_TIMEOUT for writes, 5 and 10 seconds by default.
 func New() DBService {
 	// Reuse Connection
 	if dbInstance != nil {
 		return dbInstance
 	}
 
-	database := os.Getenv("DB_DATABASE")
-	password := os.Getenv("DB_PASSWORD")
-	username := os.Getenv("DB_USERNAME")
-	port := os.Getenv("DB_PORT")
-	host := os.Getenv("DB_HOST")
-	schema := os.Getenv("DB_SCHEMA")
-	sslmode := os.Getenv("DB_SSLMODE")
-
-	connStr := fmt.Sprintf(
-		"postgres://%s:%s@%s:%s/%s?sslmode=%s&search_path=%s",
-		username, password, host, port, database, sslmode, schema,
+	switch driver := os.Getenv("DB_DRIVER"); driver {
+	case "", "postgres":
+		dbInstance = newPostgres(ConfigFromEnv())
+	case "sqlite":
+		db, err := NewSQLite(sqlitePath())
+		if err != nil {
+			log.Fatal(err)
+		}
+		dbInstance = db
+	case "memory":
+		dbInstance = NewMemory()
+	default:
+		log.Fatalf("unknown DB_DRIVER %q, want postgres, sqlite or memory", driver)
+	}
+	dbInstance = withTimeouts(dbInstance,
+		parseTimeout("DB_READ_TIMEOUT", os.Getenv("DB_READ_TIMEOUT"), defaultReadTimeout),
+		parseTimeout("DB_WRITE_TIMEOUT", os.Getenv("DB_WRITE_TIMEOUT"), defaultWriteTimeout),
 	)
-	db, err := sql.Open("pgx", connStr)
+	return dbInstance
+}
+
+func newPostgres(cfg Config) *dbService {
+	db, err := sql.Open("pgx", cfg.DSN())
 	if err != nil {
 		log.Fatal(err)
 	}
-	dbInstance = &dbService{
-		db: db,
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	return &dbService{
+		db:           db,
+		maxIdleConns: cfg.MaxIdleConns,
 	}
-	return dbInstance
+}
+
+// isUniqueViolation reports whether err was caused by a unique constraint.
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "23505"
+	}
+	code := sqliteCode(err)
+	return code == sqlite3.SQLITE_CONSTRAINT_UNIQUE || code == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+}
+
+// isForeignKeyViolation reports whether err was caused by a foreign key
+// constraint.
+func isForeignKeyViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "23503"
+	}
+	return sqliteCode(err) == sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY
 }
 
 // Health checks the health of the database connection by pinging the database.
 // It returns a map with keys indicating various health statistics.
-func (s *dbService) Health() map[string]string {
-	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+func (s *dbService) Health(ctx context.Context) map[string]string {
+	ctx, cancel := context.WithTimeout(ctx, 1*time.Second)
 	defer cancel()
 
 	stats := make(map[string]string)
@@ -79,16 +228,20 @@ func (s *dbService) Health() map[string]string {
 	if err != nil {
 		stats["status"] = "down"
 		stats["error"] = fmt.Sprintf("db down: %v", err)
-		log.Fatalf("db down: %v", err) // Log the error and terminate the program
+		log.Printf("db down: %v", err)
 		return stats
 	}
 
 	// Database is up, add more statistics
 	stats["status"] = "up"
-	stats["message"] = "It's healthy"
 
 	// Get database stats (like open connections, in use, idle, etc.)
 	dbStats := s.db.Stats()
+	s.healthMu.Lock()
+	previous := s.lastStats
+	s.lastStats = dbStats
+	s.healthMu.Unlock()
+	stats["max_open_connections"] = strconv.Itoa(dbStats.MaxOpenConnections)
 	stats["open_connections"] = strconv.Itoa(dbStats.OpenConnections)
 	stats["in_use"] = strconv.Itoa(dbStats.InUse)
 	stats["idle"] = strconv.Itoa(dbStats.Idle)
@@ -97,24 +250,45 @@ func (s *dbService) Health() map[string]string {
 	stats["max_idle_closed"] = strconv.FormatInt(dbStats.MaxIdleClosed, 10)
 	stats["max_lifetime_closed"] = strconv.FormatInt(dbStats.MaxLifetimeClosed, 10)
 
-	// Evaluate stats to provide a health message
-	if dbStats.OpenConnections > 40 { // Assuming 50 is the max for this example
-		stats["message"] = "The database is experiencing heavy load."
+	stats["message"] = healthMessage(previous, dbStats, s.maxIdleConns)
+	return stats
+}
+
+// healthMessage describes the state of a connection pool from its statistics
+// now and at the previous check, given the limit of idle connections. The
+// waits and closed connections are counted since the previous check, and
+// judged against the size of the pool: a pool that waits for a connection
+// more often than it may open connections is short of them, and one that
+// closes more idle connections than it may keep, or replaces more than half
+// of its connections for their age, keeps opening new ones.
+func healthMessage(previous, current sql.DBStats, maxIdleConns int) string {
+	message := "It's healthy"
+	maxOpen := int64(current.MaxOpenConnections)
+
+	if heavyLoad(current) {
+		message = "The database is experiencing heavy load."
 	}
 
-	if dbStats.WaitCount > 1000 {
-		stats["message"] = "The database has a high number of wait events, indicating potential bottlenecks."
+	if maxOpen > 0 && current.WaitCount-previous.WaitCount > maxOpen {
+		message = "The database has a high number of wait events, indicating potential bottlenecks."
 	}
 
-	if dbStats.MaxIdleClosed > int64(dbStats.OpenConnections)/2 {
-		stats["message"] = "Many idle connections are being closed, consider revising the connection pool settings."
+	if current.MaxIdleClosed-previous.MaxIdleClosed > int64(maxIdleConns) {
+		message = "Many idle connections are being closed, consider revising the connection pool settings."
 	}
 
-	if dbStats.MaxLifetimeClosed > int64(dbStats.OpenConnections)/2 {
-		stats["message"] = "Many connections are being closed due to max lifetime, consider increasing max lifetime or revising the connection usage pattern."
+	if maxOpen > 0 && current.MaxLifetimeClosed-previous.MaxLifetimeClosed > maxOpen/2 {
+		message = "Many connections are being closed due to max lifetime, consider increasing max lifetime or revising the connection usage pattern."
 	}
 
-	return stats
+	return message
+}
+
+// heavyLoad reports whether the pool has opened at least 80% of the
+// connections it may, beyond which calls start waiting for one. A pool
+// without a limit is never considered loaded.
+func heavyLoad(stats sql.DBStats) bool {
+	return stats.MaxOpenConnections > 0 && stats.OpenConnections*5 >= stats.MaxOpenConnections*4
 }
 
 // Close closes the database connection.
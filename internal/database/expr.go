@@ -0,0 +1,376 @@
+package database
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxFilterLength and maxFilterDepth bound the work a single filter
+	// expression can cause.
+	maxFilterLength = 1000
+	maxFilterDepth  = 20
+)
+
+// FilterExpr is a parsed filter expression; see ParseFilter.
+type FilterExpr interface {
+	// sql returns the SQL condition of the expression, registering its
+	// values as arguments of b.
+	sql(b *queryBuilder) string
+}
+
+// FilterError reports a malformed filter expression.
+type FilterError struct {
+	// Pos is the 1-based byte offset of the problem in the expression.
+	Pos int
+	Msg string
+}
+
+func (e *FilterError) Error() string {
+	return fmt.Sprintf("%s at position %d", e.Msg, e.Pos)
+}
+
+// filterType is the kind of value a filter field holds.
+type filterType int
+
+const (
+	filterBool filterType = iota
+	filterInt
+	filterRef  // an ID that may be null
+	filterTime // a timestamp that may be null
+	filterText
+	filterTag
+)
+
+// filterFields maps the fields a filter expression may compare to their
+// columns. Only these column names ever reach the SQL.
+var filterFields = map[string]struct {
+	column string
+	typ    filterType
+}{
+	"completed":    {"completed", filterBool},
+	"priority":     {"priority", filterInt},
+	"project_id":   {"project_id", filterRef},
+	"parent_id":    {"parent_id", filterRef},
+	"start_at":     {"start_at", filterTime},
+	"due_at":       {"due_at", filterTime},
+	"created_at":   {"created_at", filterTime},
+	"updated_at":   {"updated_at", filterTime},
+	"completed_at": {"completed_at", filterTime},
+	"title":        {"title", filterText},
+	"description":  {"coalesce(description, '')", filterText},
+	"tag":          {"", filterTag},
+}
+
+// filterOperators lists the comparison operators, longest first so that ">="
+// is not read as ">".
+var filterOperators = []string{">=", "<=", "!=", ":", "=", ">", "<", "~"}
+
+// ParseFilter parses a filter expression such as
+//
+//	completed:false AND (priority>=2 OR tag:urgent) AND NOT due_at:null
+//
+// Conditions compare a field with a value and are combined with AND, OR, NOT
+// and parentheses; AND binds tighter than OR and keywords are case-insensitive.
+// The operators are = (or :), !=, <, <=, >, >= and ~, which matches text
+// fields containing the value regardless of case. Values containing spaces,
+// parentheses or quotes are written in double quotes, with \" and \\ as
+// escapes. Times are RFC 3339 timestamps or dates as accepted by
+// ParseFilterTime, and fields without a value match null.
+//
+// The fields are completed, priority, project_id, parent_id, start_at, due_at,
+// created_at, updated_at, completed_at, title, description and tag, which
+// matches todos carrying the tag, or not carrying it with !=. Malformed
+// expressions are reported as a *FilterError.
+func ParseFilter(s string) (FilterExpr, error) {
+	if len(s) > maxFilterLength {
+		return nil, &FilterError{maxFilterLength + 1, fmt.Sprintf("filter is longer than %d characters", maxFilterLength)}
+	}
+	p := &filterParser{input: s}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.skipSpace(); p.pos < len(p.input) {
+		return nil, p.errorf(p.pos, "unexpected %q", p.peekToken())
+	}
+	return expr, nil
+}
+
+// ParseFilterTime parses a time given in a filter: either an RFC 3339
+// timestamp or a date such as 2024-05-01, which stands for midnight local
+// time.
+func ParseFilterTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation(time.DateOnly, s, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, want an RFC 3339 timestamp or a date", s)
+	}
+	return t, nil
+}
+
+type filterParser struct {
+	input string
+	pos   int
+	depth int
+}
+
+func (p *filterParser) errorf(pos int, format string, args ...any) *FilterError {
+	return &FilterError{pos + 1, fmt.Sprintf(format, args...)}
+}
+
+func (p *filterParser) skipSpace() {
+	for p.pos < len(p.input) && (p.input[p.pos] == ' ' || p.input[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+// peekToken returns the text at the current position up to the next space or
+// parenthesis, for use in error messages.
+func (p *filterParser) peekToken() string {
+	end := p.pos
+	for end < len(p.input) && !strings.ContainsRune(" \t()", rune(p.input[end])) {
+		end++
+	}
+	if end == p.pos {
+		end++
+	}
+	return p.input[p.pos:end]
+}
+
+// keyword consumes the keyword at the current position, if it is there and
+// followed by a space, a parenthesis or the end of the expression.
+func (p *filterParser) keyword(word string) bool {
+	p.skipSpace()
+	end := p.pos + len(word)
+	if end > len(p.input) || !strings.EqualFold(p.input[p.pos:end], word) {
+		return false
+	}
+	if end < len(p.input) && !strings.ContainsRune(" \t()", rune(p.input[end])) {
+		return false
+	}
+	p.pos = end
+	return true
+}
+
+func (p *filterParser) parseOr() (FilterExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("OR") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = logicalExpr{"OR", left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (FilterExpr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("AND") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = logicalExpr{"AND", left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseUnary() (FilterExpr, error) {
+	p.skipSpace()
+	start := p.pos
+	if p.depth++; p.depth > maxFilterDepth {
+		return nil, p.errorf(start, "filter is nested more than %d levels deep", maxFilterDepth)
+	}
+	defer func() { p.depth-- }()
+
+	if p.keyword("NOT") {
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{expr}, nil
+	}
+	if p.pos < len(p.input) && p.input[p.pos] == '(' {
+		p.pos++
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.skipSpace(); p.pos >= len(p.input) || p.input[p.pos] != ')' {
+			return nil, p.errorf(start, "unclosed parenthesis")
+		}
+		p.pos++
+		return expr, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *filterParser) parseComparison() (FilterExpr, error) {
+	start := p.pos
+	for p.pos < len(p.input) && (p.input[p.pos] == '_' || p.input[p.pos] >= 'a' && p.input[p.pos] <= 'z') {
+		p.pos++
+	}
+	name := p.input[start:p.pos]
+	if name == "" {
+		if p.pos >= len(p.input) {
+			return nil, p.errorf(p.pos, "expected a condition")
+		}
+		return nil, p.errorf(p.pos, "expected a field name, got %q", p.peekToken())
+	}
+	field, ok := filterFields[name]
+	if !ok {
+		return nil, p.errorf(start, "unknown field %q", name)
+	}
+
+	p.skipSpace()
+	opPos := p.pos
+	var op string
+	for _, candidate := range filterOperators {
+		if strings.HasPrefix(p.input[p.pos:], candidate) {
+			op = candidate
+			p.pos += len(op)
+			break
+		}
+	}
+	if op == "" {
+		return nil, p.errorf(opPos, "expected an operator after %q", name)
+	}
+	if op == ":" {
+		op = "="
+	}
+
+	p.skipSpace()
+	valuePos := p.pos
+	value, quoted, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	c := comparison{field: name, column: field.column, typ: field.typ, op: op}
+	if !quoted && strings.EqualFold(value, "null") {
+		if op != "=" && op != "!=" || field.typ != filterRef && field.typ != filterTime {
+			return nil, p.errorf(opPos, "%s cannot be compared with null using %s", name, op)
+		}
+		return c, nil
+	}
+
+	allowed := "=, !=, <, <=, >, >="
+	switch field.typ {
+	case filterBool, filterRef, filterTag:
+		allowed = "=, !="
+	case filterText:
+		allowed = "=, !=, ~"
+	}
+	if !strings.Contains(allowed+",", op+",") {
+		return nil, p.errorf(opPos, "%s only supports %s", name, allowed)
+	}
+
+	switch field.typ {
+	case filterBool:
+		c.value, err = strconv.ParseBool(value)
+	case filterInt, filterRef:
+		c.value, err = strconv.Atoi(value)
+	case filterTime:
+		c.value, err = ParseFilterTime(value)
+	case filterText:
+		c.value = value
+	case filterTag:
+		c.value = strings.ToLower(strings.TrimSpace(value))
+	}
+	if err != nil {
+		return nil, p.errorf(valuePos, "invalid value %q for %s", value, name)
+	}
+	return c, nil
+}
+
+// parseValue reads a bare or double-quoted value and reports whether it was
+// quoted.
+func (p *filterParser) parseValue() (string, bool, error) {
+	start := p.pos
+	if p.pos < len(p.input) && p.input[p.pos] == '"' {
+		var value strings.Builder
+		for p.pos++; p.pos < len(p.input); p.pos++ {
+			switch c := p.input[p.pos]; {
+			case c == '"':
+				p.pos++
+				return value.String(), true, nil
+			case c == '\\' && p.pos+1 < len(p.input):
+				p.pos++
+				value.WriteByte(p.input[p.pos])
+			default:
+				value.WriteByte(c)
+			}
+		}
+		return "", false, p.errorf(start, "unterminated quoted value")
+	}
+
+	for p.pos < len(p.input) && !strings.ContainsRune(" \t()\"", rune(p.input[p.pos])) {
+		p.pos++
+	}
+	if p.pos == start {
+		return "", false, p.errorf(start, "expected a value")
+	}
+	return p.input[start:p.pos], false, nil
+}
+
+type logicalExpr struct {
+	op          string
+	left, right FilterExpr
+}
+
+func (e logicalExpr) sql(b *queryBuilder) string {
+	return "(" + e.left.sql(b) + " " + e.op + " " + e.right.sql(b) + ")"
+}
+
+type notExpr struct {
+	expr FilterExpr
+}
+
+func (e notExpr) sql(b *queryBuilder) string {
+	return "NOT " + e.expr.sql(b)
+}
+
+// comparison compares a column with a value; a nil value stands for null.
+type comparison struct {
+	field  string
+	column string
+	typ    filterType
+	op     string
+	value  any
+}
+
+func (c comparison) sql(b *queryBuilder) string {
+	switch {
+	case c.value == nil && c.op == "=":
+		return "(" + c.column + " IS NULL)"
+	case c.value == nil:
+		return "(" + c.column + " IS NOT NULL)"
+	case c.typ == filterTag:
+		tagged := "id IN (SELECT tt.todo_id FROM todo_tags tt JOIN tags t ON t.id = tt.tag_id WHERE t.name = " + b.arg(c.value) + ")"
+		if c.op == "!=" {
+			return "NOT " + tagged
+		}
+		return tagged
+	case c.op == "~":
+		return "(" + b.ilike(c.column, b.arg(containsPattern(c.value.(string)))) + ")"
+	case c.op == "!=":
+		return "(" + c.column + " IS DISTINCT FROM " + b.arg(c.value) + ")"
+	}
+	return "(" + c.column + " " + c.op + " " + b.arg(c.value) + ")"
+}
+
+// containsPattern returns the LIKE pattern matching text containing s.
+func containsPattern(s string) string {
+	return "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s) + "%"
+}
@@ -0,0 +1,309 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DueFilter selects todos by the position of their due date relative to now.
+type DueFilter string
+
+const (
+	// DueAny disables due date filtering.
+	DueAny DueFilter = ""
+	// DueOverdue matches open todos whose due date has already passed.
+	DueOverdue DueFilter = "overdue"
+	// DueToday matches todos due at any time during the current day.
+	DueToday DueFilter = "today"
+	// DueWithin matches todos due between now and TodoFilter.DueWithinDays days from now.
+	DueWithin DueFilter = "within"
+)
+
+// TagMatch controls how TodoFilter.Tags are combined.
+type TagMatch string
+
+const (
+	// TagMatchAny matches todos carrying at least one of the tags.
+	TagMatchAny TagMatch = "any"
+	// TagMatchAll matches todos carrying every one of the tags.
+	TagMatchAll TagMatch = "all"
+)
+
+// ArchiveFilter selects todos by whether they are archived.
+type ArchiveFilter string
+
+const (
+	// ArchivedExclude matches todos that are not archived. It is the default.
+	ArchivedExclude ArchiveFilter = ""
+	// ArchivedInclude matches todos whether or not they are archived.
+	ArchivedInclude ArchiveFilter = "include"
+	// ArchivedOnly matches archived todos only.
+	ArchivedOnly ArchiveFilter = "only"
+)
+
+// validate reports whether f is one of the known filters.
+func (f ArchiveFilter) validate() error {
+	switch f {
+	case ArchivedExclude, ArchivedInclude, ArchivedOnly:
+		return nil
+	}
+	return fmt.Errorf("unknown archive filter %q", f)
+}
+
+// condition returns the SQL condition matching the todos selected by f, or ""
+// if it selects every todo.
+func (f ArchiveFilter) condition() string {
+	switch f {
+	case ArchivedExclude:
+		return "archived_at IS NULL"
+	case ArchivedOnly:
+		return "archived_at IS NOT NULL"
+	}
+	return ""
+}
+
+// TodoFilter narrows down the todos returned by GetTodos.
+// The zero value matches every todo that is not archived.
+type TodoFilter struct {
+	Due           DueFilter
+	DueWithinDays int
+
+	Tags     []string
+	TagMatch TagMatch // defaults to TagMatchAny
+
+	ProjectID *int
+	ParentID  *int
+
+	Archived ArchiveFilter
+
+	// Completed, if set, matches todos that are, or are not, completed.
+	Completed *bool
+	// DueRange and CreatedRange match todos due and created within them.
+	DueRange     TimeRange
+	CreatedRange TimeRange
+	// Contains matches todos whose title or description contains it,
+	// regardless of case.
+	Contains string
+	// Expr, if set, is a filter expression the todos must match as well.
+	Expr FilterExpr
+
+	// Sort orders the results. Todos that compare equal, and all todos if
+	// Sort is empty, are ordered by ID.
+	Sort []SortKey
+}
+
+// TimeRange matches times at or after After and before Before. A nil bound
+// leaves the range open on that side.
+type TimeRange struct {
+	After  *time.Time
+	Before *time.Time
+}
+
+func (r TimeRange) apply(b *queryBuilder, column string) {
+	if r.After != nil {
+		b.where(column + " >= " + b.arg(*r.After))
+	}
+	if r.Before != nil {
+		b.where(column + " < " + b.arg(*r.Before))
+	}
+}
+
+// SortField names a todo attribute the results can be ordered by.
+type SortField string
+
+const (
+	SortPriority  SortField = "priority"
+	SortDueAt     SortField = "due_at"
+	SortCreatedAt SortField = "created_at"
+	SortTitle     SortField = "title"
+)
+
+// sortColumns maps every SortField to the expression it orders by.
+var sortColumns = map[SortField]string{
+	SortPriority:  "priority",
+	SortDueAt:     "due_at",
+	SortCreatedAt: "created_at",
+	SortTitle:     "lower(title)",
+}
+
+// SortKey is a single ORDER BY term.
+type SortKey struct {
+	Field SortField
+	Desc  bool
+}
+
+// ValidSortField reports whether todos can be ordered by field.
+func ValidSortField(field SortField) bool {
+	_, ok := sortColumns[field]
+	return ok
+}
+
+// queryBuilder accumulates WHERE conditions and their positional arguments.
+type queryBuilder struct {
+	dialect dialect
+	conds   []string
+	args    []any
+}
+
+// arg registers a query argument and returns its placeholder.
+func (b *queryBuilder) arg(v any) string {
+	b.args = append(b.args, v)
+	return fmt.Sprintf("$%d", len(b.args))
+}
+
+// in returns the condition matching rows whose column equals one of values, a
+// slice of ints or strings, which is passed as a single argument however long
+// it is.
+func (b *queryBuilder) in(column string, values any) string {
+	if b.dialect == dialectSQLite {
+		// SQLite has no arrays, so the values are passed as a JSON array.
+		// Marshaling a slice of ints or strings cannot fail.
+		list, _ := json.Marshal(values)
+		return column + " IN (SELECT value FROM json_each(" + b.arg(string(list)) + "))"
+	}
+	return column + " = ANY(" + b.arg(values) + ")"
+}
+
+// ilike returns the condition matching rows whose column matches the LIKE
+// pattern with the given placeholder regardless of case. LIKE in SQLite
+// already ignores case, though only that of ASCII letters.
+func (b *queryBuilder) ilike(column, pattern string) string {
+	op := " ILIKE "
+	if b.dialect == dialectSQLite {
+		op = " LIKE "
+	}
+	return column + op + pattern + ` ESCAPE '\'`
+}
+
+func (b *queryBuilder) where(cond string) {
+	b.conds = append(b.conds, cond)
+}
+
+func (b *queryBuilder) whereClause() string {
+	if len(b.conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(b.conds, " AND ")
+}
+
+// validate reports the first setting of f that is not understood.
+func (f TodoFilter) validate() error {
+	if err := f.Archived.validate(); err != nil {
+		return err
+	}
+	switch f.Due {
+	case DueAny, DueOverdue, DueToday:
+	case DueWithin:
+		if f.DueWithinDays < 0 {
+			return fmt.Errorf("due within days must not be negative, got %d", f.DueWithinDays)
+		}
+	default:
+		return fmt.Errorf("unknown due filter %q", f.Due)
+	}
+	for _, key := range f.Sort {
+		if !ValidSortField(key.Field) {
+			return fmt.Errorf("unknown sort field %q", key.Field)
+		}
+	}
+	if len(f.Tags) > 0 && f.TagMatch != "" && f.TagMatch != TagMatchAny && f.TagMatch != TagMatchAll {
+		return fmt.Errorf("unknown tag match %q", f.TagMatch)
+	}
+	return nil
+}
+
+// dueBounds returns the range of due dates matched by f.Due, which is empty
+// for DueAny and DueOverdue. Day boundaries are computed in the location of
+// now.
+func (f TodoFilter) dueBounds(now time.Time) (start, end time.Time) {
+	switch f.Due {
+	case DueToday:
+		start = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		return start, start.AddDate(0, 0, 1)
+	case DueWithin:
+		return now, now.AddDate(0, 0, f.DueWithinDays)
+	}
+	return start, end
+}
+
+// apply adds the conditions described by f to b. Day boundaries are computed
+// in the location of now. Todos in the trash never match.
+func (f TodoFilter) apply(b *queryBuilder, now time.Time) error {
+	if err := f.validate(); err != nil {
+		return err
+	}
+
+	b.where("deleted_at IS NULL")
+	if cond := f.Archived.condition(); cond != "" {
+		b.where(cond)
+	}
+
+	switch f.Due {
+	case DueOverdue:
+		b.where("NOT completed AND due_at < " + b.arg(now))
+	case DueToday, DueWithin:
+		start, end := f.dueBounds(now)
+		b.where("due_at >= " + b.arg(start) + " AND due_at < " + b.arg(end))
+	}
+
+	if f.Completed != nil {
+		b.where("completed = " + b.arg(*f.Completed))
+	}
+	f.DueRange.apply(b, "due_at")
+	f.CreatedRange.apply(b, "created_at")
+	if f.Contains != "" {
+		pattern := b.arg(containsPattern(f.Contains))
+		b.where("(" + b.ilike("title", pattern) + " OR " + b.ilike("coalesce(description, '')", pattern) + ")")
+	}
+	if f.Expr != nil {
+		b.where(f.Expr.sql(b))
+	}
+
+	if f.ProjectID != nil {
+		b.where("project_id = " + b.arg(*f.ProjectID))
+	}
+
+	if f.ParentID != nil {
+		b.where("parent_id = " + b.arg(*f.ParentID))
+	}
+
+	if len(f.Tags) > 0 {
+		tagged := "SELECT tt.todo_id FROM todo_tags tt JOIN tags t ON t.id = tt.tag_id WHERE " + b.in("t.name", f.Tags)
+		if f.TagMatch == TagMatchAll {
+			tagged += " GROUP BY tt.todo_id HAVING COUNT(DISTINCT t.id) = " + b.arg(countDistinct(f.Tags))
+		}
+		b.where("id IN (" + tagged + ")")
+	}
+	return nil
+}
+
+// orderClause returns the ORDER BY clause for f.Sort. Todos without a due date
+// sort last in both directions.
+func (f TodoFilter) orderClause() string {
+	terms := make([]string, 0, len(f.Sort)+1)
+	for _, key := range f.Sort {
+		column, ok := sortColumns[key.Field]
+		if !ok {
+			continue
+		}
+		term := column
+		if key.Desc {
+			term += " DESC"
+		}
+		if key.Field == SortDueAt {
+			term += " NULLS LAST"
+		}
+		terms = append(terms, term)
+	}
+	terms = append(terms, "id")
+	return " ORDER BY " + strings.Join(terms, ", ")
+}
+
+func countDistinct(values []string) int {
+	seen := make(map[string]bool, len(values))
+	for _, v := range values {
+		seen[v] = true
+	}
+	return len(seen)
+}
@@ -0,0 +1,136 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"go-todo/internal/models"
+)
+
+// historyFields are the todo fields compared to find the changes of a
+// revision, in the order they are reported. Bookkeeping such as the version
+// and updated_at changes with every write and is left out.
+var historyFields = []string{
+	"title", "description", "completed", "priority", "start_at", "due_at", "completed_at",
+	"project_id", "parent_id", "recurrence", "tags", "archived_at", "deleted_at",
+}
+
+const historyColumns = "version, operation, changed_at, changed_by, before, after"
+
+type actorKey struct{}
+
+// WithActor returns a copy of ctx in which the writes of todos are recorded
+// in their history as made by actor, which has to come from a source the
+// caller trusts, such as an authenticated user. Writes made without an actor
+// are recorded without one.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// setActor makes the triggers recording the history of todos attribute the
+// writes of tx to the actor of ctx. It has to run first in every transaction
+// that writes todos: in Postgres the setting ends with the transaction, and
+// in SQLite it is stored in todo_history_actor until the next one replaces it.
+//
+// The SQLite row is shared by every connection, which is only correct because
+// openSQLite allows a single one and begins transactions with the write lock
+// (_txlock=immediate), so no other transaction can replace the actor before
+// this one commits. Either change needs the actor to be kept per connection.
+func setActor(ctx context.Context, tx queryer, d dialect) error {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	if d == dialectSQLite {
+		_, err := tx.ExecContext(ctx, "UPDATE todo_history_actor SET actor = NULLIF($1, '')", actor)
+		return err
+	}
+	_, err := tx.ExecContext(ctx, "SELECT set_config('app.actor', $1, true)", actor)
+	return err
+}
+
+// GetTodoHistory returns the revisions of a todo, newest first. It returns
+// sql.ErrNoRows if the todo does not exist.
+func (s *dbService) GetTodoHistory(ctx context.Context, id int) ([]models.TodoRevision, error) {
+	rows, err := s.conn().QueryContext(ctx, "SELECT "+historyColumns+" FROM todo_history WHERE todo_id = $1 ORDER BY id DESC", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []models.TodoRevision
+	for rows.Next() {
+		revision, err := scanRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(revisions) == 0 {
+		var exists bool
+		if err := s.conn().QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM todos WHERE id = $1)", id).Scan(&exists); err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, sql.ErrNoRows
+		}
+	}
+	return revisions, nil
+}
+
+// GetTodoRevision returns the revision of a todo that left it at the given
+// version. It returns sql.ErrNoRows if there is no such revision.
+func (s *dbService) GetTodoRevision(ctx context.Context, id, version int) (models.TodoRevision, error) {
+	return scanRevision(s.conn().QueryRowContext(ctx,
+		"SELECT "+historyColumns+" FROM todo_history WHERE todo_id = $1 AND version = $2 ORDER BY id DESC LIMIT 1",
+		id, version,
+	))
+}
+
+func scanRevision(row rowScanner) (models.TodoRevision, error) {
+	revision := models.TodoRevision{Changes: []models.FieldChange{}}
+	var changedBy sql.NullString
+	var before, after []byte
+	if err := row.Scan(&revision.Version, &revision.Operation, &revision.ChangedAt, &changedBy, &before, &after); err != nil {
+		return models.TodoRevision{}, err
+	}
+	if changedBy.Valid {
+		revision.ChangedBy = &changedBy.String
+	}
+	if err := json.Unmarshal(after, &revision.After); err != nil {
+		return models.TodoRevision{}, err
+	}
+	if before == nil {
+		return revision, nil
+	}
+	if err := json.Unmarshal(before, &revision.Before); err != nil {
+		return models.TodoRevision{}, err
+	}
+
+	var err error
+	revision.Changes, err = fieldChanges(before, after)
+	if err != nil {
+		return models.TodoRevision{}, err
+	}
+	return revision, nil
+}
+
+// fieldChanges compares the historyFields of two JSON snapshots of a todo.
+func fieldChanges(before, after []byte) ([]models.FieldChange, error) {
+	var from, to map[string]json.RawMessage
+	if err := json.Unmarshal(before, &from); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(after, &to); err != nil {
+		return nil, err
+	}
+	changes := []models.FieldChange{}
+	for _, field := range historyFields {
+		if !bytes.Equal(from[field], to[field]) {
+			changes = append(changes, models.FieldChange{Field: field, Before: from[field], After: to[field]})
+		}
+	}
+	return changes, nil
+}
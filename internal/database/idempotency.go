@@ -0,0 +1,91 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// IdempotencyRecord is the stored outcome of a request made with an
+// Idempotency-Key header.
+type IdempotencyRecord struct {
+	Key string
+	// RequestHash identifies the request the key was first used with.
+	RequestHash string
+	// Status is the response status, or 0 while the request is in progress.
+	Status int
+	Header map[string]string
+	Body   []byte
+}
+
+// ReserveIdempotencyKey claims key for the request identified by requestHash
+// for ttl and returns nil. If the key is already claimed and has not expired,
+// it returns the existing record instead, which may still be in progress.
+// Expired keys are removed on the way.
+func (s *dbService) ReserveIdempotencyKey(ctx context.Context, key, requestHash string, ttl time.Duration) (*IdempotencyRecord, error) {
+	now := time.Now()
+	if _, err := s.conn().ExecContext(ctx, "DELETE FROM idempotency_keys WHERE expires_at <= $1", now); err != nil {
+		return nil, err
+	}
+
+	for {
+		err := s.conn().QueryRowContext(ctx,
+			"INSERT INTO idempotency_keys (key, request_hash, expires_at) VALUES ($1, $2, $3) "+
+				"ON CONFLICT (key) DO NOTHING RETURNING key",
+			key, requestHash, now.Add(ttl),
+		).Scan(&key)
+		if err == nil {
+			return nil, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+
+		record, err := s.idempotencyRecord(ctx, key)
+		// The key was released or removed as expired since the insert, so
+		// it can be claimed after all.
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		return record, err
+	}
+}
+
+// idempotencyRecord returns the record stored for key.
+func (s *dbService) idempotencyRecord(ctx context.Context, key string) (*IdempotencyRecord, error) {
+	record := IdempotencyRecord{Key: key}
+	var header []byte
+	err := s.conn().QueryRowContext(ctx,
+		"SELECT request_hash, status, header, body FROM idempotency_keys WHERE key = $1", key,
+	).Scan(&record.RequestHash, &record.Status, &header, &record.Body)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(header, &record.Header); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// CompleteIdempotencyKey stores the response of the request that reserved
+// record.Key so that retries replay it.
+func (s *dbService) CompleteIdempotencyKey(ctx context.Context, record IdempotencyRecord) error {
+	header, err := json.Marshal(record.Header)
+	if err != nil {
+		return err
+	}
+	_, err = s.conn().ExecContext(ctx,
+		"UPDATE idempotency_keys SET status = $1, header = $2, body = $3 WHERE key = $4",
+		record.Status, string(header), record.Body, record.Key,
+	)
+	return err
+}
+
+// ReleaseIdempotencyKey forgets key, so that the request that reserved it can
+// be retried, for instance after it failed with a server error.
+func (s *dbService) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	_, err := s.conn().ExecContext(ctx, "DELETE FROM idempotency_keys WHERE key = $1", key)
+	return err
+}
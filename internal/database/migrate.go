@@ -0,0 +1,139 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"go-todo/migrations"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
+	migratepg "github.com/golang-migrate/migrate/v4/database/postgres"
+	migratesqlite "github.com/golang-migrate/migrate/v4/database/sqlite"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+// migrationLockTimeout is how long a migration waits for another replica
+// that is migrating the same database to finish.
+const migrationLockTimeout = 5 * time.Minute
+
+// Migrator applies the migrations embedded in the binary to the Postgres or
+// SQLite database. With Postgres, the commands that change the schema hold an
+// advisory lock while they run, so that replicas migrating at the same time
+// take turns and each migration is applied once.
+type Migrator struct {
+	m *migrate.Migrate
+}
+
+// NewMigrator connects to the database selected by DB_DRIVER, which must be
+// postgres or sqlite, as configured by the DB_* environment variables.
+func NewMigrator() (*Migrator, error) {
+	var db *sql.DB
+	var err error
+	migratorFor := newMigrator
+	switch driver := os.Getenv("DB_DRIVER"); driver {
+	case "", "postgres":
+		db, err = sql.Open("pgx", ConfigFromEnv().DSN())
+	case "sqlite":
+		db, err = openSQLite(sqlitePath())
+		migratorFor = newSQLiteMigrator
+	default:
+		return nil, fmt.Errorf("DB_DRIVER %s has no migrations", driver)
+	}
+	if err != nil {
+		return nil, err
+	}
+	m, err := migratorFor(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return m, nil
+}
+
+// newMigrator returns a Migrator for the Postgres database db, which it
+// closes when it is closed.
+func newMigrator(db *sql.DB) (*Migrator, error) {
+	driver, err := migratepg.WithInstance(db, &migratepg.Config{})
+	if err != nil {
+		return nil, err
+	}
+	return newMigratorWith(migrations.FS, ".", "postgres", driver)
+}
+
+// newSQLiteMigrator returns a Migrator for the SQLite database db, which it
+// closes when it is closed.
+func newSQLiteMigrator(db *sql.DB) (*Migrator, error) {
+	driver, err := migratesqlite.WithInstance(db, &migratesqlite.Config{})
+	if err != nil {
+		return nil, err
+	}
+	return newMigratorWith(migrations.SQLite, "sqlite", "sqlite", driver)
+}
+
+// newMigratorWith returns a Migrator applying the migrations in the dir
+// directory of fsys through driver.
+func newMigratorWith(fsys fs.FS, dir, name string, driver database.Driver) (*Migrator, error) {
+	source, err := iofs.New(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	m, err := migrate.NewWithInstance("iofs", source, name, driver)
+	if err != nil {
+		return nil, err
+	}
+	m.LockTimeout = migrationLockTimeout
+	return &Migrator{m: m}, nil
+}
+
+// Up applies all migrations that have not been applied yet.
+func (m *Migrator) Up() error {
+	return migrationError(m.m.Up())
+}
+
+// Down rolls back the last steps migrations.
+func (m *Migrator) Down(steps int) error {
+	return migrationError(m.m.Steps(-steps))
+}
+
+// DownAll rolls back every migration applied.
+func (m *Migrator) DownAll() error {
+	return migrationError(m.m.Down())
+}
+
+// Version returns the version of the last migration applied, 0 if there is
+// none, and whether it failed halfway and left the schema dirty.
+func (m *Migrator) Version() (version uint, dirty bool, err error) {
+	version, dirty, err = m.m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return 0, false, nil
+	}
+	return version, dirty, err
+}
+
+// Force sets the version without running any migration and clears the dirty
+// flag, once the schema has been fixed by hand after a failed migration.
+// A version of -1 means no migration has been applied.
+func (m *Migrator) Force(version int) error {
+	return m.m.Force(version)
+}
+
+// Close closes the connection to the database.
+func (m *Migrator) Close() error {
+	sourceErr, dbErr := m.m.Close()
+	return errors.Join(sourceErr, dbErr)
+}
+
+func migrationError(err error) error {
+	var dirty migrate.ErrDirty
+	switch {
+	case errors.Is(err, migrate.ErrNoChange):
+		return nil
+	case errors.As(err, &dirty):
+		return fmt.Errorf("migration %d failed and left the schema dirty; fix it by hand, then force the version", dirty.Version)
+	}
+	return err
+}
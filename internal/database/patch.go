@@ -0,0 +1,124 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"go-todo/internal/models"
+	"slices"
+	"strings"
+)
+
+// patchColumns maps every patchable todo column, which matches the field's
+// JSON name, to the value to write. Tags are stored separately and handled by
+// PatchTodo.
+var patchColumns = map[string]func(todo *models.Todo) any{
+	"title":       func(todo *models.Todo) any { return todo.Title },
+	"description": func(todo *models.Todo) any { return todo.Description },
+	"completed":   func(todo *models.Todo) any { return todo.Completed },
+	"priority":    func(todo *models.Todo) any { return todo.Priority },
+	"start_at":    func(todo *models.Todo) any { return todo.StartAt },
+	"due_at":      func(todo *models.Todo) any { return todo.DueAt },
+	"project_id":  func(todo *models.Todo) any { return todo.ProjectID },
+	"parent_id":   func(todo *models.Todo) any { return todo.ParentID },
+	"recurrence":  func(todo *models.Todo) any { return todo.Recurrence },
+}
+
+// PatchableTodoField reports whether field can be passed to PatchTodo.
+func PatchableTodoField(field string) bool {
+	_, ok := patchColumns[field]
+	return ok || field == "tags"
+}
+
+// PatchTodo writes the fields of todo named in fields, using their JSON names,
+// in a single UPDATE and leaves the other columns untouched. todo is then
+// refreshed with the stored state of every field. Like UpdateTodo, it returns
+// ErrVersionMismatch unless the stored version equals todo.Version. It returns
+// sql.ErrNoRows if the todo does not exist, ErrInvalidReference if its project
+// or parent does not exist and ErrCycle if it would become its own ancestor.
+func (s *dbService) PatchTodo(ctx context.Context, todo *models.Todo, fields []string) error {
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stored, err := patchTodo(ctx, tx, todo, fields)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	todos := []models.Todo{stored}
+	if err := s.loadRelations(ctx, todos); err != nil {
+		return err
+	}
+	*todo = todos[0]
+	return nil
+}
+
+// patchTodo writes the listed fields of todo within tx and returns the stored
+// todo without its relations.
+func patchTodo(ctx context.Context, tx queryer, todo *models.Todo, fields []string) (models.Todo, error) {
+	if slices.Contains(fields, "parent_id") && todo.ParentID != nil {
+		if err := checkParent(ctx, tx, todo.ID, *todo.ParentID); err != nil {
+			return models.Todo{}, err
+		}
+	}
+
+	var b queryBuilder
+	var sets []string
+	for _, field := range fields {
+		if field == "tags" {
+			continue
+		}
+		value, ok := patchColumns[field]
+		if !ok {
+			return models.Todo{}, fmt.Errorf("database: unknown todo field %q", field)
+		}
+		sets = append(sets, field+" = "+b.arg(value(todo)))
+	}
+
+	if len(sets) == 0 && len(fields) > 0 {
+		// Touch the row so that changing only the tags bumps the version; the
+		// triggers set updated_at to the current time.
+		sets = append(sets, "updated_at = updated_at")
+	}
+
+	where := " WHERE id = " + b.arg(todo.ID) + " AND version = " + b.arg(todo.Version) + " AND deleted_at IS NULL"
+	if len(sets) > 0 {
+		res, err := tx.ExecContext(ctx, "UPDATE todos SET "+strings.Join(sets, ", ")+where, b.args...)
+		if isForeignKeyViolation(err) {
+			return models.Todo{}, ErrInvalidReference
+		}
+		if err != nil {
+			return models.Todo{}, err
+		}
+		updated, err := res.RowsAffected()
+		if err != nil {
+			return models.Todo{}, err
+		}
+		if updated == 0 {
+			return models.Todo{}, versionError(ctx, tx, todo.ID)
+		}
+		// The update bumped the version, so the todo is read back by ID.
+		where, b.args = " WHERE id = $1", []any{todo.ID}
+	}
+	stored, err := scanTodo(tx.QueryRowContext(ctx, "SELECT "+todoColumns+" FROM todos"+where, b.args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Todo{}, versionError(ctx, tx, todo.ID)
+	}
+	if err != nil {
+		return models.Todo{}, err
+	}
+
+	if slices.Contains(fields, "tags") {
+		if err := setTags(ctx, tx, todo.ID, todo.Tags); err != nil {
+			return models.Todo{}, err
+		}
+	}
+	return stored, nil
+}
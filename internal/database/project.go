@@ -0,0 +1,140 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"go-todo/internal/models"
+)
+
+// ProjectDeletion describes what happens to the todos of a deleted project.
+// The zero value keeps the todos but removes them from the project.
+type ProjectDeletion struct {
+	// Cascade moves the project's todos to the trash together with the
+	// project, which restoring any of them brings back.
+	Cascade bool
+	// ReassignTo moves the project's todos to another project.
+	ReassignTo *int
+}
+
+const projectColumns = "id, name, description, created_at"
+
+func scanProject(row rowScanner) (models.Project, error) {
+	var project models.Project
+	err := row.Scan(&project.ID, &project.Name, &project.Description, &project.CreatedAt)
+	return project, err
+}
+
+func (s *dbService) GetProjects(ctx context.Context) ([]models.Project, error) {
+	rows, err := s.conn().QueryContext(ctx, "SELECT "+projectColumns+" FROM projects ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var projects []models.Project
+	for rows.Next() {
+		project, err := scanProject(rows)
+		if err != nil {
+			return nil, err
+		}
+		projects = append(projects, project)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return projects, nil
+}
+
+func (s *dbService) GetProject(ctx context.Context, id int) (models.Project, error) {
+	project, err := scanProject(s.conn().QueryRowContext(ctx, "SELECT "+projectColumns+" FROM projects WHERE id = $1", id))
+	if err != nil {
+		return models.Project{}, err
+	}
+	return project, nil
+}
+
+func (s *dbService) CreateProject(ctx context.Context, project *models.Project) error {
+	return s.conn().QueryRowContext(ctx,
+		"INSERT INTO projects (name, description) VALUES ($1, $2) RETURNING id, created_at",
+		project.Name, project.Description,
+	).Scan(&project.ID, &project.CreatedAt)
+}
+
+// trashProject moves the todos of a project to the trash and keeps the project
+// in trashed_projects, with the todos in the trash remembering it, so that
+// RestoreTodo can put them back into it once the project is deleted.
+func trashProject(ctx context.Context, tx queryer, id int) error {
+	if _, err := trashTodos(ctx, tx, "project_id = $1", id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx,
+		"INSERT INTO trashed_projects (id, name, description, created_at) "+
+			"SELECT id, name, description, created_at FROM projects WHERE id = $1",
+		id,
+	); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx,
+		"UPDATE todos SET trashed_project_id = project_id, project_id = NULL WHERE project_id = $1 AND deleted_at IS NOT NULL",
+		id,
+	)
+	return err
+}
+
+// UpdateProject writes project. It returns sql.ErrNoRows if the project does
+// not exist.
+func (s *dbService) UpdateProject(ctx context.Context, project *models.Project) error {
+	return s.conn().QueryRowContext(ctx,
+		"UPDATE projects SET name = $1, description = $2 WHERE id = $3 RETURNING created_at",
+		project.Name, project.Description, project.ID,
+	).Scan(&project.CreatedAt)
+}
+
+// DeleteProject removes a project and handles its todos as described by how.
+// It returns sql.ErrNoRows if the project does not exist and
+// ErrInvalidReference if the todos are reassigned to an unknown project.
+func (s *dbService) DeleteProject(ctx context.Context, id int, how ProjectDeletion) error {
+	if how.Cascade && how.ReassignTo != nil {
+		return errors.New("database: cannot both cascade and reassign project todos")
+	}
+	if how.ReassignTo != nil && *how.ReassignTo == id {
+		return ErrInvalidReference
+	}
+
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Lock the project so no todos are added to it while it is being deleted.
+	var locked int
+	if err := tx.QueryRowContext(ctx, "SELECT id FROM projects WHERE id = $1"+s.dialect.lockRows("FOR UPDATE"), id).Scan(&locked); err != nil {
+		return err
+	}
+
+	switch {
+	case how.Cascade:
+		err = trashProject(ctx, tx, id)
+	case how.ReassignTo != nil:
+		err = tx.QueryRowContext(ctx, "SELECT id FROM projects WHERE id = $1"+s.dialect.lockRows("FOR SHARE"), *how.ReassignTo).Scan(&locked)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInvalidReference
+		}
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, "UPDATE todos SET project_id = $1 WHERE project_id = $2", *how.ReassignTo, id)
+	default:
+		_, err = tx.ExecContext(ctx, "UPDATE todos SET project_id = NULL WHERE project_id = $1", id)
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM projects WHERE id = $1", id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,202 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"go-todo/internal/models"
+	"html"
+	"strings"
+	"unicode"
+)
+
+// Search is a parsed full-text query over todo titles and descriptions.
+// A todo matches if it matches every word, prefix and phrase.
+type Search struct {
+	// Words are matched after stemming, so "running" also finds "runs".
+	Words []string
+	// Prefixes match any word starting with them, as in "deploy*".
+	Prefixes []string
+	// Phrases match consecutive words, as in "\"release notes\"".
+	Phrases []string
+
+	// Archived selects todos by whether they are archived, like
+	// TodoFilter.Archived. Archived todos are left out by default.
+	Archived ArchiveFilter
+}
+
+// ParseSearch parses a search query such as `deploy* "release notes" api`.
+// Double quotes group a phrase and a trailing asterisk makes a word a prefix.
+func ParseSearch(q string) (Search, error) {
+	var search Search
+	for i, part := range strings.Split(q, `"`) {
+		// Odd parts are inside quotes; an unterminated quote runs to the end.
+		if i%2 == 1 {
+			if phrase := strings.Join(strings.Fields(part), " "); phrase != "" {
+				search.Phrases = append(search.Phrases, phrase)
+			}
+			continue
+		}
+		for _, word := range strings.Fields(part) {
+			if !strings.HasSuffix(word, "*") {
+				search.Words = append(search.Words, word)
+				continue
+			}
+			// Prefixes end up in to_tsquery syntax, so only keep their letters
+			// and digits. "e-mail*" searches for the word "e" and the prefix "mail".
+			pieces := strings.FieldsFunc(word, func(r rune) bool {
+				return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+			})
+			if len(pieces) == 0 {
+				continue
+			}
+			search.Words = append(search.Words, pieces[:len(pieces)-1]...)
+			search.Prefixes = append(search.Prefixes, pieces[len(pieces)-1])
+		}
+	}
+	if len(search.Words) == 0 && len(search.Prefixes) == 0 && len(search.Phrases) == 0 {
+		return Search{}, errors.New("search query has no terms")
+	}
+	return search, nil
+}
+
+// tsquery returns the SQL expression of the tsquery matching q in Postgres.
+func (q Search) tsquery(b *queryBuilder) string {
+	var terms []string
+	if len(q.Words) > 0 {
+		terms = append(terms, "plainto_tsquery('english', "+b.arg(strings.Join(q.Words, " "))+")")
+	}
+	for _, prefix := range q.Prefixes {
+		terms = append(terms, "to_tsquery('english', "+b.arg(prefix+":*")+")")
+	}
+	for _, phrase := range q.Phrases {
+		terms = append(terms, "phraseto_tsquery('english', "+b.arg(phrase)+")")
+	}
+	return strings.Join(terms, " && ")
+}
+
+// match returns the FTS5 queries matching q in SQLite: words for the words
+// and phrases, which are stemmed, and prefixes for the prefixes, which are
+// not. Every term is quoted, so that it is read as words rather than query
+// syntax. Either query is empty if q has no such terms.
+func (q Search) match() (words, prefixes string) {
+	quote := func(s string) string {
+		return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+	}
+	var terms []string
+	for _, word := range append(q.Words, q.Phrases...) {
+		terms = append(terms, quote(word))
+	}
+	words = strings.Join(terms, " AND ")
+
+	terms = terms[:0]
+	for _, prefix := range q.Prefixes {
+		terms = append(terms, quote(prefix)+" *")
+	}
+	return words, strings.Join(terms, " AND ")
+}
+
+// The databases delimit the highlighted words with STX and ETX, which are
+// never let into titles and descriptions, rather than with HTML tags, as they
+// leave the text around them as it is. markHighlights escapes the text as HTML
+// and then turns the delimiters into <mark> elements.
+const (
+	highlightStart = "\x02"
+	highlightStop  = "\x03"
+
+	titleHeadline       = "StartSel=" + highlightStart + ", StopSel=" + highlightStop + ", HighlightAll=true"
+	descriptionHeadline = "StartSel=" + highlightStart + ", StopSel=" + highlightStop + ", MaxFragments=2, MaxWords=30, MinWords=10"
+)
+
+var highlightMarkup = strings.NewReplacer(highlightStart, "<mark>", highlightStop, "</mark>")
+
+// markHighlights returns text highlighted by the database as HTML.
+func markHighlights(text string) string {
+	return highlightMarkup.Replace(html.EscapeString(text))
+}
+
+// searchQuery returns the query selecting todoColumns followed by the rank and
+// the highlighted title and description of up to limit todos matching search.
+func searchQuery(b *queryBuilder, search Search, limit int) string {
+	where := "deleted_at IS NULL"
+	if cond := search.Archived.condition(); cond != "" {
+		where += " AND " + cond
+	}
+	if b.dialect == dialectSQLite {
+		// The todos are ranked and highlighted by the words they match, or by
+		// the prefixes if there are no words. bm25 is lower for better matches
+		// and weighs the columns like the Postgres ranking weighs the title (A)
+		// and description (B).
+		table, match := "todos_search", ""
+		words, prefixes := search.match()
+		if words != "" {
+			match = b.arg(words)
+		} else {
+			table, match, prefixes = "todos_words", b.arg(prefixes), ""
+		}
+		query := "WITH matches AS (" +
+			"SELECT rowid AS id, -bm25(" + table + ", 1.0, 0.4) AS score, " +
+			"highlight(" + table + ", 0, '" + highlightStart + "', '" + highlightStop + "') AS title_highlight, " +
+			"snippet(" + table + ", 1, '" + highlightStart + "', '" + highlightStop + "', ' ... ', 30) AS description_highlight " +
+			"FROM " + table + " WHERE " + table + " MATCH " + match +
+			") SELECT " + todoColumns + ", score, title_highlight, description_highlight " +
+			"FROM todos JOIN matches USING (id) WHERE " + where
+		if prefixes != "" {
+			query += " AND id IN (SELECT rowid FROM todos_words WHERE todos_words MATCH " + b.arg(prefixes) + ")"
+		}
+		return query + " ORDER BY score DESC, id LIMIT " + b.arg(limit)
+	}
+	return "SELECT " + todoColumns + ", ts_rank(search, q) AS rank, " +
+		"ts_headline('english', title, q, '" + titleHeadline + "'), " +
+		"ts_headline('english', coalesce(description, ''), q, '" + descriptionHeadline + "') " +
+		"FROM todos CROSS JOIN (SELECT " + search.tsquery(b) + " AS q) AS query " +
+		"WHERE search @@ q AND " + where + " ORDER BY rank DESC, id LIMIT " + b.arg(limit)
+}
+
+// extraScanner scans columns selected after todoColumns into extra.
+type extraScanner struct {
+	rowScanner
+	extra []any
+}
+
+func (s extraScanner) Scan(dest ...any) error {
+	return s.rowScanner.Scan(append(dest, s.extra...)...)
+}
+
+// SearchTodos returns up to limit todos matching search, best matches first.
+// Matches in the title weigh more than matches in the description.
+func (s *dbService) SearchTodos(ctx context.Context, search Search, limit int) ([]models.SearchResult, error) {
+	if err := search.Archived.validate(); err != nil {
+		return nil, err
+	}
+	b := queryBuilder{dialect: s.dialect}
+	query := searchQuery(&b, search, limit)
+	rows, err := s.conn().QueryContext(ctx, query, b.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []models.SearchResult
+	var todos []models.Todo
+	for rows.Next() {
+		var result models.SearchResult
+		todo, err := scanTodo(extraScanner{rows, []any{&result.Rank, &result.TitleHighlight, &result.DescriptionHighlight}})
+		if err != nil {
+			return nil, err
+		}
+		result.TitleHighlight = markHighlights(result.TitleHighlight)
+		result.DescriptionHighlight = markHighlights(result.DescriptionHighlight)
+		results = append(results, result)
+		todos = append(todos, todo)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := s.loadRelations(ctx, todos); err != nil {
+		return nil, err
+	}
+	for i := range results {
+		results[i].Todo = todos[i]
+	}
+	return results, nil
+}
@@ -0,0 +1,87 @@
+package database
+
+import (
+	"cmp"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+
+	"modernc.org/sqlite"
+)
+
+// NewSQLite opens the SQLite database at path, creating it if needed, and
+// returns a DBService backed by it. The schema is migrated to the latest
+// version on the way. The data is stored in the same tables as in Postgres
+// and queried with SQL; times are stored as microseconds since the Unix
+// epoch. Several processes can share the file, but their writes take turns.
+func NewSQLite(path string) (DBService, error) {
+	db, err := openSQLite(path)
+	if err != nil {
+		return nil, err
+	}
+	// The Migrator is not closed, as that would close db.
+	m, err := newSQLiteMigrator(db)
+	if err == nil {
+		err = m.Up()
+	}
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("database: migrating %s: %w", path, err)
+	}
+	return &dbService{db: db, dialect: dialectSQLite, maxIdleConns: sqliteConns}, nil
+}
+
+// NewMemory returns a DBService backed by an SQLite database that is kept in
+// memory, so that its data is lost when the process exits. It needs no setup,
+// which makes it convenient for development and tests.
+func NewMemory() DBService {
+	db, err := NewSQLite(":memory:")
+	if err != nil {
+		log.Fatal(err)
+	}
+	return db
+}
+
+// sqlitePath returns the path of the SQLite database given by DB_PATH.
+func sqlitePath() string {
+	return cmp.Or(os.Getenv("DB_PATH"), "todo.db")
+}
+
+// sqliteConns is the number of connections to an SQLite database. A single
+// connection serializes the calls, which SQLite does anyway for writes, and
+// keeps an in-memory database alive between them.
+const sqliteConns = 1
+
+// openSQLite opens the SQLite database at path with foreign keys enforced
+// and time.Time values stored as integer microseconds, which keeps them
+// comparable in SQL. Every transaction takes the write lock when it begins,
+// waiting up to 5 seconds for another process to release it, so that
+// transactions never have to be aborted halfway to avoid a deadlock.
+func openSQLite(path string) (*sql.DB, error) {
+	params := url.Values{}
+	params.Add("_pragma", "foreign_keys(1)")
+	params.Add("_pragma", "journal_mode(WAL)")
+	params.Add("_pragma", "busy_timeout(5000)")
+	params.Set("_time_integer_format", "unix_micro")
+	params.Set("_inttotime", "1")
+	params.Set("_txlock", "immediate")
+	db, err := sql.Open("sqlite", path+"?"+params.Encode())
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(sqliteConns)
+	return db, nil
+}
+
+// sqliteCode returns the extended result code of an SQLite error, or 0 if
+// err is not one.
+func sqliteCode(err error) int {
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code()
+	}
+	return 0
+}
@@ -0,0 +1,162 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"go-todo/internal/models"
+)
+
+// GetTodoTree returns the todo with the given id and all of its descendants,
+// nested by parent. It returns sql.ErrNoRows if the todo does not exist.
+func (s *dbService) GetTodoTree(ctx context.Context, id int) (models.TodoNode, error) {
+	rows, err := s.conn().QueryContext(ctx,
+		"WITH RECURSIVE tree AS ("+
+			"SELECT id FROM todos WHERE id = $1 AND deleted_at IS NULL "+
+			"UNION SELECT t.id FROM todos t JOIN tree ON t.parent_id = tree.id WHERE t.deleted_at IS NULL"+
+			") SELECT "+todoColumns+" FROM todos WHERE id IN (SELECT id FROM tree) ORDER BY id",
+		id,
+	)
+	if err != nil {
+		return models.TodoNode{}, err
+	}
+	defer rows.Close()
+
+	var todos []models.Todo
+	for rows.Next() {
+		todo, err := scanTodo(rows)
+		if err != nil {
+			return models.TodoNode{}, err
+		}
+		todos = append(todos, todo)
+	}
+	if err := rows.Err(); err != nil {
+		return models.TodoNode{}, err
+	}
+	if len(todos) == 0 {
+		return models.TodoNode{}, sql.ErrNoRows
+	}
+	if err := s.loadRelations(ctx, todos); err != nil {
+		return models.TodoNode{}, err
+	}
+
+	return buildTree(todos, id), nil
+}
+
+// buildTree nests todos below the todo with the given root id.
+func buildTree(todos []models.Todo, root int) models.TodoNode {
+	byID := make(map[int]models.Todo, len(todos))
+	children := make(map[int][]int)
+	for _, todo := range todos {
+		byID[todo.ID] = todo
+		if todo.ParentID != nil && todo.ID != root {
+			children[*todo.ParentID] = append(children[*todo.ParentID], todo.ID)
+		}
+	}
+
+	var build func(id int) models.TodoNode
+	build = func(id int) models.TodoNode {
+		node := models.TodoNode{Todo: byID[id], Children: []models.TodoNode{}}
+		for _, child := range children[id] {
+			node.Children = append(node.Children, build(child))
+		}
+		return node
+	}
+	return build(root)
+}
+
+// CompleteDescendants marks every open descendant of the todo as completed.
+func (s *dbService) CompleteDescendants(ctx context.Context, id int) error {
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := completeDescendants(ctx, tx, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func completeDescendants(ctx context.Context, db queryer, id int) error {
+	_, err := db.ExecContext(ctx,
+		"WITH RECURSIVE descendants AS ("+
+			"SELECT id FROM todos WHERE parent_id = $1 AND deleted_at IS NULL "+
+			"UNION SELECT t.id FROM todos t JOIN descendants d ON t.parent_id = d.id WHERE t.deleted_at IS NULL"+
+			") UPDATE todos SET completed = TRUE WHERE id IN (SELECT id FROM descendants) AND NOT completed",
+		id,
+	)
+	return err
+}
+
+// loadProgress fills in the Progress of every todo that has subtasks with a
+// single query.
+func (s *dbService) loadProgress(ctx context.Context, todos []models.Todo) error {
+	if len(todos) == 0 {
+		return nil
+	}
+
+	ids := make([]int, len(todos))
+	index := make(map[int]int, len(todos))
+	for i := range todos {
+		ids[i] = todos[i].ID
+		index[todos[i].ID] = i
+		todos[i].Progress = nil
+	}
+
+	b := queryBuilder{dialect: s.dialect}
+	rows, err := s.conn().QueryContext(ctx,
+		"WITH RECURSIVE descendants AS ("+
+			"SELECT parent_id AS root_id, id, completed FROM todos WHERE "+b.in("parent_id", ids)+" AND deleted_at IS NULL "+
+			"UNION SELECT d.root_id, t.id, t.completed FROM todos t JOIN descendants d ON t.parent_id = d.id "+
+			"WHERE t.deleted_at IS NULL"+
+			") SELECT root_id, COUNT(*), COUNT(*) FILTER (WHERE completed) FROM descendants GROUP BY root_id",
+		b.args...,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rootID, total, completed int
+		if err := rows.Scan(&rootID, &total, &completed); err != nil {
+			return err
+		}
+		// Rounded down so that 100 always means every subtask is done.
+		progress := completed * 100 / total
+		todos[index[rootID]].Progress = &progress
+	}
+	return rows.Err()
+}
+
+// checkParent returns ErrCycle if making parentID the parent of the todo
+// with the given id would make the todo its own ancestor, and
+// ErrInvalidReference if the parent is in the trash.
+func checkParent(ctx context.Context, tx queryer, id, parentID int) error {
+	var trashed bool
+	err := tx.QueryRowContext(ctx, "SELECT deleted_at IS NOT NULL FROM todos WHERE id = $1", parentID).Scan(&trashed)
+	if trashed {
+		return ErrInvalidReference
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	var cycle bool
+	err = tx.QueryRowContext(ctx,
+		"WITH RECURSIVE ancestors AS ("+
+			"SELECT id, parent_id FROM todos WHERE id = $1 "+
+			"UNION SELECT t.id, t.parent_id FROM todos t JOIN ancestors a ON t.id = a.parent_id"+
+			") SELECT EXISTS (SELECT 1 FROM ancestors WHERE id = $2)",
+		parentID, id,
+	).Scan(&cycle)
+	if err != nil {
+		return err
+	}
+	if cycle {
+		return ErrCycle
+	}
+	return nil
+}
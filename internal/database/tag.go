@@ -0,0 +1,175 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"go-todo/internal/models"
+	"strings"
+)
+
+func (s *dbService) GetTags(ctx context.Context) ([]models.Tag, error) {
+	rows, err := s.conn().QueryContext(ctx, "SELECT id, name FROM tags ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []models.Tag
+	for rows.Next() {
+		var tag models.Tag
+		if err := rows.Scan(&tag.ID, &tag.Name); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+func (s *dbService) GetTag(ctx context.Context, id int) (models.Tag, error) {
+	var tag models.Tag
+	err := s.conn().QueryRowContext(ctx, "SELECT id, name FROM tags WHERE id = $1", id).Scan(&tag.ID, &tag.Name)
+	if err != nil {
+		return models.Tag{}, err
+	}
+	return tag, nil
+}
+
+// CreateTag inserts tag and fills in its ID. It returns ErrConflict if a tag
+// with the same name already exists.
+func (s *dbService) CreateTag(ctx context.Context, tag *models.Tag) error {
+	err := s.conn().QueryRowContext(ctx, "INSERT INTO tags (name) VALUES ($1) RETURNING id", tag.Name).Scan(&tag.ID)
+	if isUniqueViolation(err) {
+		return ErrConflict
+	}
+	return err
+}
+
+// UpdateTag renames tag. The todos carrying it are written as well, so that
+// their versions change and the new name is recorded in their history. It
+// returns sql.ErrNoRows if the tag does not exist and ErrConflict if the new
+// name is already taken.
+func (s *dbService) UpdateTag(ctx context.Context, tag *models.Tag) error {
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, "UPDATE tags SET name = $1 WHERE id = $2", tag.Name, tag.ID)
+	if isUniqueViolation(err) {
+		return ErrConflict
+	}
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	if err := touchTagged(ctx, tx, tag.ID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteTag removes a tag and detaches it from every todo. Like UpdateTag,
+// it writes the todos that carried it.
+func (s *dbService) DeleteTag(ctx context.Context, id int) error {
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// The todos are written while they still carry the tag: SQLite records
+	// the revision right away and drops the tag from it when the tag goes.
+	if err := touchTagged(ctx, tx, id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM tags WHERE id = $1", id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// touchTagged writes the todos carrying the tag without changing them, which
+// bumps their versions and records a revision of each.
+func touchTagged(ctx context.Context, tx queryer, tagID int) error {
+	_, err := tx.ExecContext(ctx,
+		"UPDATE todos SET updated_at = updated_at WHERE id IN (SELECT todo_id FROM todo_tags WHERE tag_id = $1)",
+		tagID,
+	)
+	return err
+}
+
+// loadTags fills in the Tags of every todo with a single query.
+func (s *dbService) loadTags(ctx context.Context, todos []models.Todo) error {
+	if len(todos) == 0 {
+		return nil
+	}
+
+	ids := make([]int, len(todos))
+	index := make(map[int]int, len(todos))
+	for i := range todos {
+		ids[i] = todos[i].ID
+		index[todos[i].ID] = i
+		todos[i].Tags = []string{}
+	}
+
+	b := queryBuilder{dialect: s.dialect}
+	rows, err := s.conn().QueryContext(ctx,
+		"SELECT tt.todo_id, t.name FROM todo_tags tt JOIN tags t ON t.id = tt.tag_id "+
+			"WHERE "+b.in("tt.todo_id", ids)+" ORDER BY t.name",
+		b.args...,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var todoID int
+		var name string
+		if err := rows.Scan(&todoID, &name); err != nil {
+			return err
+		}
+		i := index[todoID]
+		todos[i].Tags = append(todos[i].Tags, name)
+	}
+	return rows.Err()
+}
+
+// setTags replaces the tags attached to a todo, creating tags that do not
+// exist yet.
+func setTags(ctx context.Context, tx queryer, todoID int, names []string) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM todo_tags WHERE todo_id = $1", todoID); err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	var b queryBuilder
+	placeholders := make([]string, len(names))
+	for i, name := range names {
+		placeholders[i] = b.arg(name)
+	}
+	if _, err := tx.ExecContext(ctx,
+		"INSERT INTO tags (name) VALUES ("+strings.Join(placeholders, "), (")+") ON CONFLICT (name) DO NOTHING",
+		b.args...,
+	); err != nil {
+		return err
+	}
+	// The query is built before the call, which would otherwise be free to
+	// read b.args before b.arg adds the todo ID to them.
+	query := "INSERT INTO todo_tags (todo_id, tag_id) SELECT CAST(" + b.arg(todoID) + " AS INTEGER), id FROM tags " +
+		"WHERE name IN (" + strings.Join(placeholders, ", ") + ")"
+	_, err := tx.ExecContext(ctx, query, b.args...)
+	return err
+}
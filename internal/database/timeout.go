@@ -0,0 +1,263 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"go-todo/internal/models"
+	"log"
+	"time"
+)
+
+// Default limits on how long a single call to the database may take unless
+// DB_READ_TIMEOUT or DB_WRITE_TIMEOUT say otherwise.
+const (
+	defaultReadTimeout  = 5 * time.Second
+	defaultWriteTimeout = 10 * time.Second
+)
+
+// parseTimeout returns the duration given by the environment variable name,
+// such as "2s", or fallback if it is unset or invalid. 0 disables the timeout.
+func parseTimeout(name, value string, fallback time.Duration) time.Duration {
+	if value == "" {
+		return fallback
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout < 0 {
+		log.Printf("invalid %s %q, falling back to %v", name, value, fallback)
+		return fallback
+	}
+	return timeout
+}
+
+// timeoutStore is a DBService that limits how long the calls to the one it
+// wraps may take, on top of any deadline the caller's context already has.
+// Reads and writes have limits of their own; a limit of 0 means none.
+type timeoutStore struct {
+	db    DBService
+	read  time.Duration
+	write time.Duration
+}
+
+// withTimeouts wraps db so that reads are canceled after read and writes
+// after write.
+func withTimeouts(db DBService, read, write time.Duration) DBService {
+	return &timeoutStore{db: db, read: read, write: write}
+}
+
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout == 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+func (s *timeoutStore) reading(ctx context.Context) (context.Context, context.CancelFunc) {
+	return withTimeout(ctx, s.read)
+}
+
+func (s *timeoutStore) writing(ctx context.Context) (context.Context, context.CancelFunc) {
+	return withTimeout(ctx, s.write)
+}
+
+// Health is not limited here; it has a timeout of its own.
+func (s *timeoutStore) Health(ctx context.Context) map[string]string {
+	return s.db.Health(ctx)
+}
+
+// WithTx limits the whole transaction like a single write. The calls made
+// within fn are not limited any further.
+func (s *timeoutStore) WithTx(ctx context.Context, isolation sql.IsolationLevel, fn func(tx Store) error) error {
+	ctx, cancel := s.writing(ctx)
+	defer cancel()
+	return s.db.WithTx(ctx, isolation, fn)
+}
+
+func (s *timeoutStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *timeoutStore) GetTodos(ctx context.Context, filter TodoFilter) ([]models.Todo, error) {
+	ctx, cancel := s.reading(ctx)
+	defer cancel()
+	return s.db.GetTodos(ctx, filter)
+}
+
+func (s *timeoutStore) GetTodoPage(ctx context.Context, filter TodoFilter, limit int, cursor string) (TodoPage, error) {
+	ctx, cancel := s.reading(ctx)
+	defer cancel()
+	return s.db.GetTodoPage(ctx, filter, limit, cursor)
+}
+
+func (s *timeoutStore) SearchTodos(ctx context.Context, search Search, limit int) ([]models.SearchResult, error) {
+	ctx, cancel := s.reading(ctx)
+	defer cancel()
+	return s.db.SearchTodos(ctx, search, limit)
+}
+
+func (s *timeoutStore) GetTodo(ctx context.Context, id int) (models.Todo, error) {
+	ctx, cancel := s.reading(ctx)
+	defer cancel()
+	return s.db.GetTodo(ctx, id)
+}
+
+func (s *timeoutStore) CreateTodo(ctx context.Context, todo *models.Todo) error {
+	ctx, cancel := s.writing(ctx)
+	defer cancel()
+	return s.db.CreateTodo(ctx, todo)
+}
+
+func (s *timeoutStore) UpdateTodo(ctx context.Context, todo *models.Todo) error {
+	ctx, cancel := s.writing(ctx)
+	defer cancel()
+	return s.db.UpdateTodo(ctx, todo)
+}
+
+func (s *timeoutStore) PatchTodo(ctx context.Context, todo *models.Todo, fields []string) error {
+	ctx, cancel := s.writing(ctx)
+	defer cancel()
+	return s.db.PatchTodo(ctx, todo, fields)
+}
+
+func (s *timeoutStore) DeleteTodo(ctx context.Context, id int) error {
+	ctx, cancel := s.writing(ctx)
+	defer cancel()
+	return s.db.DeleteTodo(ctx, id)
+}
+
+func (s *timeoutStore) ApplyTodoOperations(ctx context.Context, ops []TodoOperation, atomic bool) ([]TodoOperationResult, error) {
+	ctx, cancel := s.writing(ctx)
+	defer cancel()
+	return s.db.ApplyTodoOperations(ctx, ops, atomic)
+}
+
+func (s *timeoutStore) GetTodoHistory(ctx context.Context, id int) ([]models.TodoRevision, error) {
+	ctx, cancel := s.reading(ctx)
+	defer cancel()
+	return s.db.GetTodoHistory(ctx, id)
+}
+
+func (s *timeoutStore) GetTodoRevision(ctx context.Context, id, version int) (models.TodoRevision, error) {
+	ctx, cancel := s.reading(ctx)
+	defer cancel()
+	return s.db.GetTodoRevision(ctx, id, version)
+}
+
+func (s *timeoutStore) ArchiveCompletedTodos(ctx context.Context, before time.Time) (int64, error) {
+	ctx, cancel := s.writing(ctx)
+	defer cancel()
+	return s.db.ArchiveCompletedTodos(ctx, before)
+}
+
+func (s *timeoutStore) GetTrash(ctx context.Context) ([]models.Todo, error) {
+	ctx, cancel := s.reading(ctx)
+	defer cancel()
+	return s.db.GetTrash(ctx)
+}
+
+func (s *timeoutStore) RestoreTodo(ctx context.Context, id int) error {
+	ctx, cancel := s.writing(ctx)
+	defer cancel()
+	return s.db.RestoreTodo(ctx, id)
+}
+
+func (s *timeoutStore) PurgeTodo(ctx context.Context, id int) error {
+	ctx, cancel := s.writing(ctx)
+	defer cancel()
+	return s.db.PurgeTodo(ctx, id)
+}
+
+func (s *timeoutStore) PurgeTrash(ctx context.Context, before time.Time) (int64, error) {
+	ctx, cancel := s.writing(ctx)
+	defer cancel()
+	return s.db.PurgeTrash(ctx, before)
+}
+
+func (s *timeoutStore) GetTodoTree(ctx context.Context, id int) (models.TodoNode, error) {
+	ctx, cancel := s.reading(ctx)
+	defer cancel()
+	return s.db.GetTodoTree(ctx, id)
+}
+
+func (s *timeoutStore) CompleteDescendants(ctx context.Context, id int) error {
+	ctx, cancel := s.writing(ctx)
+	defer cancel()
+	return s.db.CompleteDescendants(ctx, id)
+}
+
+func (s *timeoutStore) GetTags(ctx context.Context) ([]models.Tag, error) {
+	ctx, cancel := s.reading(ctx)
+	defer cancel()
+	return s.db.GetTags(ctx)
+}
+
+func (s *timeoutStore) GetTag(ctx context.Context, id int) (models.Tag, error) {
+	ctx, cancel := s.reading(ctx)
+	defer cancel()
+	return s.db.GetTag(ctx, id)
+}
+
+func (s *timeoutStore) CreateTag(ctx context.Context, tag *models.Tag) error {
+	ctx, cancel := s.writing(ctx)
+	defer cancel()
+	return s.db.CreateTag(ctx, tag)
+}
+
+func (s *timeoutStore) UpdateTag(ctx context.Context, tag *models.Tag) error {
+	ctx, cancel := s.writing(ctx)
+	defer cancel()
+	return s.db.UpdateTag(ctx, tag)
+}
+
+func (s *timeoutStore) DeleteTag(ctx context.Context, id int) error {
+	ctx, cancel := s.writing(ctx)
+	defer cancel()
+	return s.db.DeleteTag(ctx, id)
+}
+
+func (s *timeoutStore) GetProjects(ctx context.Context) ([]models.Project, error) {
+	ctx, cancel := s.reading(ctx)
+	defer cancel()
+	return s.db.GetProjects(ctx)
+}
+
+func (s *timeoutStore) GetProject(ctx context.Context, id int) (models.Project, error) {
+	ctx, cancel := s.reading(ctx)
+	defer cancel()
+	return s.db.GetProject(ctx, id)
+}
+
+func (s *timeoutStore) CreateProject(ctx context.Context, project *models.Project) error {
+	ctx, cancel := s.writing(ctx)
+	defer cancel()
+	return s.db.CreateProject(ctx, project)
+}
+
+func (s *timeoutStore) UpdateProject(ctx context.Context, project *models.Project) error {
+	ctx, cancel := s.writing(ctx)
+	defer cancel()
+	return s.db.UpdateProject(ctx, project)
+}
+
+func (s *timeoutStore) DeleteProject(ctx context.Context, id int, how ProjectDeletion) error {
+	ctx, cancel := s.writing(ctx)
+	defer cancel()
+	return s.db.DeleteProject(ctx, id, how)
+}
+
+func (s *timeoutStore) ReserveIdempotencyKey(ctx context.Context, key, requestHash string, ttl time.Duration) (*IdempotencyRecord, error) {
+	ctx, cancel := s.writing(ctx)
+	defer cancel()
+	return s.db.ReserveIdempotencyKey(ctx, key, requestHash, ttl)
+}
+
+func (s *timeoutStore) CompleteIdempotencyKey(ctx context.Context, record IdempotencyRecord) error {
+	ctx, cancel := s.writing(ctx)
+	defer cancel()
+	return s.db.CompleteIdempotencyKey(ctx, record)
+}
+
+func (s *timeoutStore) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	ctx, cancel := s.writing(ctx)
+	defer cancel()
+	return s.db.ReleaseIdempotencyKey(ctx, key)
+}
@@ -1,12 +1,91 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
 	"go-todo/internal/models"
+	"time"
 )
 
-func (s *dbService) GetTodos() ([]models.Todo, error) {
-	rows, err := s.db.Query("SELECT id, title, description, completed FROM todos")
+const todoColumns = "id, title, description, completed, priority, start_at, due_at, " +
+	"created_at, updated_at, completed_at, project_id, parent_id, recurrence, version, archived_at, deleted_at"
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanTodo(row rowScanner) (models.Todo, error) {
+	var todo models.Todo
+	err := row.Scan(
+		&todo.ID, &todo.Title, &todo.Description, &todo.Completed, &todo.Priority, &todo.StartAt, &todo.DueAt,
+		&todo.CreatedAt, &todo.UpdatedAt, &todo.CompletedAt, &todo.ProjectID, &todo.ParentID,
+		&todo.Recurrence, &todo.Version, &todo.ArchivedAt, &todo.DeletedAt,
+	)
+	return todo, err
+}
+
+func (s *dbService) GetTodos(ctx context.Context, filter TodoFilter) ([]models.Todo, error) {
+	b := queryBuilder{dialect: s.dialect}
+	if err := filter.apply(&b, time.Now()); err != nil {
+		return nil, err
+	}
+
+	return s.queryTodos(ctx, "SELECT "+todoColumns+" FROM todos"+b.whereClause()+filter.orderClause(), b.args...)
+}
+
+// TodoPage is one page of a todo listing.
+type TodoPage struct {
+	Todos []models.Todo
+	// Next is the cursor of the following page; it is empty on the last page.
+	Next string
+}
+
+// GetTodoPage returns up to limit todos matching filter that follow cursor, or
+// the first page if cursor is empty. Pages are keyed on the sort values of the
+// last todo rather than an offset, so todos inserted or deleted concurrently
+// do not shift the remaining pages. It returns ErrInvalidCursor if cursor was
+// not issued for the same sort order.
+func (s *dbService) GetTodoPage(ctx context.Context, filter TodoFilter, limit int, cursor string) (TodoPage, error) {
+	if limit < 1 {
+		return TodoPage{}, fmt.Errorf("page limit must be positive, got %d", limit)
+	}
+
+	b := queryBuilder{dialect: s.dialect}
+	if err := filter.apply(&b, time.Now()); err != nil {
+		return TodoPage{}, err
+	}
+	if cursor != "" {
+		c, values, err := decodeCursor(cursor, filter.Sort)
+		if err != nil {
+			return TodoPage{}, err
+		}
+		c.after(&b, filter.Sort, values)
+	}
+
+	// Fetch one extra todo to find out whether there is a next page. The
+	// query is built first, as b.arg adds the limit to b.args.
+	query := "SELECT " + todoColumns + " FROM todos" + b.whereClause() + filter.orderClause() + " LIMIT " + b.arg(limit+1)
+	todos, err := s.queryTodos(ctx, query, b.args...)
+	if err != nil {
+		return TodoPage{}, err
+	}
+
+	page := TodoPage{Todos: todos}
+	if len(todos) > limit {
+		page.Todos = todos[:limit]
+		page.Next, err = encodeCursor(todos[limit-1], filter.Sort)
+		if err != nil {
+			return TodoPage{}, err
+		}
+	}
+	return page, nil
+}
+
+// queryTodos runs a query selecting todoColumns and loads the relations of the
+// resulting todos.
+func (s *dbService) queryTodos(ctx context.Context, query string, args ...any) ([]models.Todo, error) {
+	rows, err := s.conn().QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -14,8 +93,8 @@ func (s *dbService) GetTodos() ([]models.Todo, error) {
 
 	var todos []models.Todo
 	for rows.Next() {
-		var todo models.Todo
-		if err := rows.Scan(&todo.ID, &todo.Title, &todo.Description, &todo.Completed); err != nil {
+		todo, err := scanTodo(rows)
+		if err != nil {
 			return nil, err
 		}
 		todos = append(todos, todo)
@@ -23,44 +102,159 @@ func (s *dbService) GetTodos() ([]models.Todo, error) {
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
+	if err := s.loadRelations(ctx, todos); err != nil {
+		return nil, err
+	}
 	return todos, nil
 }
 
-func (s *dbService) GetTodo(id int) (models.Todo, error) {
-	var todo models.Todo
-	err := s.db.QueryRow("SELECT id, title, description, completed FROM todos WHERE id = $1", id).Scan(&todo.ID, &todo.Title, &todo.Description, &todo.Completed)
+func (s *dbService) GetTodo(ctx context.Context, id int) (models.Todo, error) {
+	todo, err := scanTodo(s.conn().QueryRowContext(ctx, "SELECT "+todoColumns+" FROM todos WHERE id = $1 AND deleted_at IS NULL", id))
 	if err != nil {
 		return models.Todo{}, err
 	}
-	return todo, nil
+	todos := []models.Todo{todo}
+	if err := s.loadRelations(ctx, todos); err != nil {
+		return models.Todo{}, err
+	}
+	return todos[0], nil
+}
+
+// CreateTodo inserts todo together with its tags and fills in its ID and the
+// audit timestamps assigned by the database. It returns ErrInvalidReference if
+// the todo's project or parent does not exist.
+func (s *dbService) CreateTodo(ctx context.Context, todo *models.Todo) error {
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := createTodo(ctx, tx, todo); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-func (s *dbService) CreateTodo(todo *models.Todo) error {
-	return s.db.QueryRow(
-		"INSERT INTO todos (title, description, completed) VALUES ($1, $2, $3) RETURNING id",
-		todo.Title, todo.Description, todo.Completed,
+// createTodo inserts todo and its tags within tx.
+func createTodo(ctx context.Context, tx queryer, todo *models.Todo) error {
+	if todo.ParentID != nil {
+		if err := checkParent(ctx, tx, 0, *todo.ParentID); err != nil {
+			return err
+		}
+	}
+
+	err := tx.QueryRowContext(ctx,
+		"INSERT INTO todos (title, description, completed, priority, start_at, due_at, project_id, parent_id, recurrence) "+
+			"VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id",
+		todo.Title, todo.Description, todo.Completed, todo.Priority, todo.StartAt, todo.DueAt, todo.ProjectID, todo.ParentID,
+		todo.Recurrence,
 	).Scan(&todo.ID)
+	if isForeignKeyViolation(err) {
+		return ErrInvalidReference
+	}
+	if err != nil {
+		return err
+	}
+	// The columns maintained by triggers are read back separately, as
+	// RETURNING in SQLite misses the changes made by its AFTER triggers.
+	err = tx.QueryRowContext(ctx,
+		"SELECT created_at, updated_at, completed_at, version FROM todos WHERE id = $1", todo.ID,
+	).Scan(&todo.CreatedAt, &todo.UpdatedAt, &todo.CompletedAt, &todo.Version)
+	if err != nil {
+		return err
+	}
+	return setTags(ctx, tx, todo.ID, todo.Tags)
 }
 
-func (s *dbService) UpdateTodo(todo *models.Todo) error {
-	res, err := s.db.Exec("UPDATE todos SET title = $1, description = $2, completed = $3 WHERE id = $4", todo.Title, todo.Description, todo.Completed, todo.ID)
+// UpdateTodo writes todo, replaces its tags and refreshes its audit
+// timestamps and version. The database sets completed_at when a todo becomes
+// completed and clears it, and archived_at, when the todo is reopened. The write only succeeds
+// if the stored version still equals todo.Version; otherwise it returns
+// ErrVersionMismatch. It returns sql.ErrNoRows if the todo does not exist,
+// ErrInvalidReference if its project or parent does not and ErrCycle if the
+// new parent is one of the todo's descendants.
+func (s *dbService) UpdateTodo(ctx context.Context, todo *models.Todo) error {
+	tx, err := s.begin(ctx)
 	if err != nil {
 		return err
 	}
-	rowsAffected, err := res.RowsAffected()
+	defer tx.Rollback()
+
+	if todo.ParentID != nil {
+		if err := checkParent(ctx, tx, todo.ID, *todo.ParentID); err != nil {
+			return err
+		}
+	}
+
+	res, err := tx.ExecContext(ctx,
+		"UPDATE todos SET title = $1, description = $2, completed = $3, priority = $4, start_at = $5, due_at = $6, "+
+			"project_id = $7, parent_id = $8, recurrence = $9 WHERE id = $10 AND version = $11 AND deleted_at IS NULL",
+		todo.Title, todo.Description, todo.Completed, todo.Priority, todo.StartAt, todo.DueAt, todo.ProjectID, todo.ParentID,
+		todo.Recurrence, todo.ID, todo.Version,
+	)
+	if isForeignKeyViolation(err) {
+		return ErrInvalidReference
+	}
 	if err != nil {
 		return err
 	}
-	if rowsAffected == 0 {
-		return sql.ErrNoRows
+	updated, err := res.RowsAffected()
+	if err != nil {
+		return err
 	}
-	return nil
+	if updated == 0 {
+		return versionError(ctx, tx, todo.ID)
+	}
+	err = tx.QueryRowContext(ctx,
+		"SELECT created_at, updated_at, completed_at, archived_at, version FROM todos WHERE id = $1", todo.ID,
+	).Scan(&todo.CreatedAt, &todo.UpdatedAt, &todo.CompletedAt, &todo.ArchivedAt, &todo.Version)
+	if err != nil {
+		return err
+	}
+	if err := setTags(ctx, tx, todo.ID, todo.Tags); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// versionError explains why a versioned write of the todo with the given ID
+// matched no row: ErrVersionMismatch if the todo exists, sql.ErrNoRows if it
+// does not or is in the trash.
+func versionError(ctx context.Context, tx queryer, id int) error {
+	var exists bool
+	if err := tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM todos WHERE id = $1 AND deleted_at IS NULL)", id).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		return ErrVersionMismatch
+	}
+	return sql.ErrNoRows
 }
 
-func (s *dbService) DeleteTodo(id int) error {
-	_, err := s.db.Exec("DELETE FROM todos WHERE id = $1", id)
+// loadRelations fills in the tags and subtask progress of todos.
+func (s *dbService) loadRelations(ctx context.Context, todos []models.Todo) error {
+	if err := s.loadTags(ctx, todos); err != nil {
+		return err
+	}
+	return s.loadProgress(ctx, todos)
+}
+
+// DeleteTodo moves a todo together with all of its subtasks to the trash. It
+// returns sql.ErrNoRows if the todo does not exist or is already in the trash.
+func (s *dbService) DeleteTodo(ctx context.Context, id int) error {
+	tx, err := s.begin(ctx)
 	if err != nil {
 		return err
 	}
-	return nil
+	defer tx.Rollback()
+
+	trashed, err := trashTodos(ctx, tx, "id = $1", id)
+	if err != nil {
+		return err
+	}
+	if trashed == 0 {
+		return sql.ErrNoRows
+	}
+	return tx.Commit()
 }
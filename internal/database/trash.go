@@ -0,0 +1,146 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"go-todo/internal/models"
+	"time"
+)
+
+// trashTodos moves the todos matching cond, together with their subtasks, to
+// the trash and returns how many todos it moved. Todos trashed together share
+// the same deleted_at, which is how RestoreTodo finds them again.
+func trashTodos(ctx context.Context, db queryer, cond string, args ...any) (int64, error) {
+	args = append(args, time.Now())
+	res, err := db.ExecContext(ctx,
+		"WITH RECURSIVE tree AS ("+
+			"SELECT id FROM todos WHERE "+cond+" AND deleted_at IS NULL "+
+			"UNION SELECT t.id FROM todos t JOIN tree ON t.parent_id = tree.id WHERE t.deleted_at IS NULL"+
+			") UPDATE todos SET deleted_at = "+fmt.Sprintf("$%d", len(args))+" WHERE id IN (SELECT id FROM tree)",
+		args...,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// GetTrash returns the todos in the trash, most recently deleted first.
+func (s *dbService) GetTrash(ctx context.Context) ([]models.Todo, error) {
+	return s.queryTodos(ctx, "SELECT "+todoColumns+" FROM todos WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC, id")
+}
+
+// RestoreTodo takes a todo out of the trash together with the subtasks that
+// were deleted along with it. Todos trashed with their project go back into
+// it, which is recreated if it no longer exists. It returns sql.ErrNoRows if
+// the todo is not in the trash and ErrInvalidReference if its parent still is.
+func (s *dbService) RestoreTodo(ctx context.Context, id int) error {
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var deletedAt time.Time
+	var parentTrashed bool
+	err = tx.QueryRowContext(ctx,
+		"SELECT t.deleted_at, p.deleted_at IS NOT NULL FROM todos t LEFT JOIN todos p ON p.id = t.parent_id "+
+			"WHERE t.id = $1 AND t.deleted_at IS NOT NULL"+s.dialect.lockRows("FOR UPDATE OF t"),
+		id,
+	).Scan(&deletedAt, &parentTrashed)
+	if err != nil {
+		return err
+	}
+	if parentTrashed {
+		return ErrInvalidReference
+	}
+
+	const tree = "WITH RECURSIVE tree AS (" +
+		"SELECT id FROM todos WHERE id = $1 " +
+		"UNION SELECT t.id FROM todos t JOIN tree ON t.parent_id = tree.id WHERE t.deleted_at = $2" +
+		") "
+	_, err = tx.ExecContext(ctx,
+		tree+"INSERT INTO projects (id, name, description, created_at) "+
+			"SELECT id, name, description, created_at FROM trashed_projects "+
+			"WHERE id IN (SELECT trashed_project_id FROM todos WHERE id IN (SELECT id FROM tree)) "+
+			"ON CONFLICT (id) DO NOTHING",
+		id, deletedAt,
+	)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx,
+		tree+"UPDATE todos SET deleted_at = NULL, "+
+			"project_id = coalesce(trashed_project_id, project_id), trashed_project_id = NULL "+
+			"WHERE id IN (SELECT id FROM tree)",
+		id, deletedAt,
+	)
+	if err != nil {
+		return err
+	}
+	if err := forgetTrashedProjects(ctx, tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// forgetTrashedProjects removes the trashed projects none of whose todos is
+// left in the trash.
+func forgetTrashedProjects(ctx context.Context, db queryer) error {
+	_, err := db.ExecContext(ctx,
+		"DELETE FROM trashed_projects WHERE id NOT IN "+
+			"(SELECT trashed_project_id FROM todos WHERE trashed_project_id IS NOT NULL)",
+	)
+	return err
+}
+
+// PurgeTodo permanently deletes a todo in the trash together with its
+// subtasks. It returns sql.ErrNoRows if the todo is not in the trash.
+func (s *dbService) PurgeTodo(ctx context.Context, id int) error {
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, "DELETE FROM todos WHERE id = $1 AND deleted_at IS NOT NULL", id)
+	if err != nil {
+		return err
+	}
+	purged, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if purged == 0 {
+		return sql.ErrNoRows
+	}
+	if err := forgetTrashedProjects(ctx, tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// PurgeTrash permanently deletes the todos that were moved to the trash before
+// the given time and returns how many it deleted, not counting subtasks that
+// were still outside the trash.
+func (s *dbService) PurgeTrash(ctx context.Context, before time.Time) (int64, error) {
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, "DELETE FROM todos WHERE deleted_at < $1", before)
+	if err != nil {
+		return 0, err
+	}
+	purged, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if err := forgetTrashedProjects(ctx, tx); err != nil {
+		return 0, err
+	}
+	return purged, tx.Commit()
+}
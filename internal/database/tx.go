@@ -0,0 +1,148 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// maxTxAttempts is how often WithTx runs a transaction that fails because of
+// concurrent transactions before it gives up.
+const maxTxAttempts = 5
+
+// txRetryDelay is how long WithTx waits before the second attempt of a
+// transaction; the delay doubles with every further attempt.
+const txRetryDelay = 10 * time.Millisecond
+
+// queryer is implemented by *sql.DB, *sql.Tx and callTx.
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// conn returns what statements run on: the transaction of a WithTx callback,
+// or the connection pool.
+func (s *dbService) conn() queryer {
+	if s.tx != nil {
+		return s.tx
+	}
+	return s.db
+}
+
+// callTx is the transaction of a single call that runs several statements.
+// Within WithTx, it is a savepoint of the surrounding transaction instead, so
+// that a failed call is undone without aborting the whole transaction.
+type callTx struct {
+	*sql.Tx
+	ctx       context.Context
+	savepoint bool
+	done      bool
+}
+
+// begin starts the transaction of a call.
+func (s *dbService) begin(ctx context.Context) (*callTx, error) {
+	if s.tx == nil {
+		tx, err := s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+		if err := setActor(ctx, tx, s.dialect); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		return &callTx{Tx: tx}, nil
+	}
+	if _, err := s.tx.ExecContext(ctx, "SAVEPOINT store_call"); err != nil {
+		return nil, err
+	}
+	return &callTx{Tx: s.tx, ctx: ctx, savepoint: true}, nil
+}
+
+func (tx *callTx) Commit() error {
+	if !tx.savepoint {
+		return tx.Tx.Commit()
+	}
+	tx.done = true
+	_, err := tx.ExecContext(tx.ctx, "RELEASE SAVEPOINT store_call")
+	return err
+}
+
+// Rollback undoes the call. Like sql.Tx.Rollback, it does nothing but return
+// sql.ErrTxDone once the call is committed, so it can be deferred.
+func (tx *callTx) Rollback() error {
+	if !tx.savepoint {
+		return tx.Tx.Rollback()
+	}
+	if tx.done {
+		return sql.ErrTxDone
+	}
+	tx.done = true
+	// A canceled call is still undone, as the surrounding transaction may
+	// otherwise be left aborted.
+	ctx := context.WithoutCancel(tx.ctx)
+	if _, err := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT store_call"); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, "RELEASE SAVEPOINT store_call")
+	return err
+}
+
+// WithTx runs fn in a transaction, retrying it when Postgres aborts it because
+// of a serialization failure or a deadlock, or when SQLite finds the database
+// locked by another process for too long. Calls made within fn join the
+// transaction of fn's Store. SQLite transactions are always serializable.
+func (s *dbService) WithTx(ctx context.Context, isolation sql.IsolationLevel, fn func(tx Store) error) error {
+	if s.tx != nil {
+		return fn(s)
+	}
+
+	delay := txRetryDelay
+	for attempt := 1; ; attempt++ {
+		err := s.runTx(ctx, isolation, fn)
+		if !isTxConflict(err) {
+			return err
+		}
+		if attempt == maxTxAttempts {
+			return fmt.Errorf("%w: %w", ErrTxConflict, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+func (s *dbService) runTx(ctx context.Context, isolation sql.IsolationLevel, fn func(tx Store) error) error {
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: isolation})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := setActor(ctx, tx, s.dialect); err != nil {
+		return err
+	}
+	if err := fn(&dbService{db: s.db, tx: tx, dialect: s.dialect}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// isTxConflict reports whether err was caused by a serialization failure, a
+// deadlock or a locked database, after which the transaction can be retried.
+func isTxConflict(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "40001" || pgErr.Code == "40P01"
+	}
+	return sqliteCode(err)&0xff == sqlite3.SQLITE_BUSY
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// TodoRevision is a recorded write of a todo. Before is nil for the revision
+// that created the todo.
+type TodoRevision struct {
+	// Version is the version of the todo after the write.
+	Version   int       `json:"version"`
+	Operation string    `json:"operation" enums:"create,update,delete,restore"`
+	ChangedAt time.Time `json:"changed_at"`
+	// ChangedBy identifies who made the write. The API has no user
+	// identity, so it is nil for the writes made through it.
+	ChangedBy *string `json:"changed_by"`
+	Before    *Todo   `json:"before"`
+	After     Todo    `json:"after"`
+	// Changes lists the fields that differ between Before and After.
+	Changes []FieldChange `json:"changes"`
+}
+
+// FieldChange is the old and new JSON value of a changed todo field.
+type FieldChange struct {
+	Field  string          `json:"field"`
+	Before json.RawMessage `json:"before" swaggertype:"object"`
+	After  json.RawMessage `json:"after" swaggertype:"object"`
+}
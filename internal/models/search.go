@@ -0,0 +1,11 @@
+package models
+
+// SearchResult is a todo matching a full-text search. The highlights repeat
+// the title and an excerpt of the description with the matching words
+// wrapped in <mark> tags, as HTML: the text itself is escaped.
+type SearchResult struct {
+	Todo                 Todo    `json:"todo"`
+	Rank                 float64 `json:"rank"`
+	TitleHighlight       string  `json:"title_highlight"`
+	DescriptionHighlight string  `json:"description_highlight"`
+}
@@ -1,8 +1,39 @@
 package models
 
+import "time"
+
 type Todo struct {
-	ID          int    `json:"id"`
-	Title       string `json:"title"`
-	Description string `json:"description"`
-	Completed   bool   `json:"completed"`
+	ID          int        `json:"id"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Completed   bool       `json:"completed"`
+	Priority    int        `json:"priority"` // 0 (none) to 4 (highest)
+	StartAt     *time.Time `json:"start_at"`
+	DueAt       *time.Time `json:"due_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+	Tags        []string   `json:"tags"`
+	ProjectID   *int       `json:"project_id"`
+	ParentID    *int       `json:"parent_id"`
+	// Recurrence is an RFC 5545 RRULE, such as "FREQ=WEEKLY;BYDAY=MO".
+	// Completing a recurring todo creates its next occurrence.
+	Recurrence string `json:"recurrence"`
+	// Progress is the percentage of completed subtasks, counting every
+	// descendant. It is nil for todos without subtasks.
+	Progress *int `json:"progress"`
+	// Version is incremented on every write of the todo. Its ETag combines
+	// it with the progress and tags, which change without a write of the
+	// todo itself.
+	Version int `json:"version"`
+	// ArchivedAt is set while the completed todo is archived.
+	ArchivedAt *time.Time `json:"archived_at"`
+	// DeletedAt is set while the todo is in the trash.
+	DeletedAt *time.Time `json:"deleted_at"`
+}
+
+// TodoNode is a todo together with its nested subtasks.
+type TodoNode struct {
+	Todo
+	Children []TodoNode `json:"children"`
 }
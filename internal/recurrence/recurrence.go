@@ -0,0 +1,288 @@
+// Package recurrence implements the subset of RFC 5545 recurrence rules
+// (RRULE) used for repeating todos.
+//
+// Supported parts are FREQ (DAILY, WEEKLY, MONTHLY, YEARLY), INTERVAL,
+// BYDAY (weekly rules only, without numeric prefixes), BYMONTHDAY (monthly
+// rules only), COUNT and UNTIL. The shorthands "daily", "weekly", "monthly"
+// and "yearly" are accepted as well. Weeks start on Monday.
+package recurrence
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Frequency string
+
+const (
+	Daily   Frequency = "DAILY"
+	Weekly  Frequency = "WEEKLY"
+	Monthly Frequency = "MONTHLY"
+	Yearly  Frequency = "YEARLY"
+)
+
+// Rule is a parsed recurrence rule. Occurrences are anchored at the time
+// passed to Next, which keeps its time of day and location.
+type Rule struct {
+	Freq     Frequency
+	Interval int
+	// ByDay lists the weekdays a weekly rule repeats on. Empty means the
+	// weekday of the anchor.
+	ByDay []time.Weekday
+	// ByMonthDay lists the days a monthly rule repeats on. Negative values
+	// count from the end of the month, so -1 is the last day.
+	ByMonthDay []int
+	// Count is the total number of occurrences, including the anchor.
+	// Zero means unlimited.
+	Count int
+	// Until is the last instant an occurrence may fall on.
+	Until *time.Time
+}
+
+var weekdays = map[string]time.Weekday{
+	"MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday, "TH": time.Thursday,
+	"FR": time.Friday, "SA": time.Saturday, "SU": time.Sunday,
+}
+
+// Parse parses an RRULE value such as "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH"
+// or one of the shorthands "daily", "weekly", "monthly" and "yearly".
+func Parse(s string) (Rule, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	switch shorthand := Frequency(strings.ToUpper(s)); shorthand {
+	case Daily, Weekly, Monthly, Yearly:
+		return Rule{Freq: shorthand, Interval: 1}, nil
+	}
+
+	rule := Rule{Interval: 1}
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(s, ";") {
+		key, value, ok := strings.Cut(part, "=")
+		key = strings.ToUpper(key)
+		if !ok || value == "" {
+			return Rule{}, fmt.Errorf("invalid rule part %q", part)
+		}
+		if seen[key] {
+			return Rule{}, fmt.Errorf("duplicate rule part %s", key)
+		}
+		seen[key] = true
+
+		switch key {
+		case "FREQ":
+			rule.Freq = Frequency(strings.ToUpper(value))
+			if !slices.Contains([]Frequency{Daily, Weekly, Monthly, Yearly}, rule.Freq) {
+				return Rule{}, fmt.Errorf("unsupported FREQ %q", value)
+			}
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return Rule{}, fmt.Errorf("invalid INTERVAL %q", value)
+			}
+			rule.Interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return Rule{}, fmt.Errorf("invalid COUNT %q", value)
+			}
+			rule.Count = n
+		case "UNTIL":
+			until, err := parseUntil(value)
+			if err != nil {
+				return Rule{}, err
+			}
+			rule.Until = &until
+		case "BYDAY":
+			for _, day := range strings.Split(value, ",") {
+				weekday, ok := weekdays[strings.ToUpper(day)]
+				if !ok {
+					return Rule{}, fmt.Errorf("unsupported BYDAY value %q", day)
+				}
+				if !slices.Contains(rule.ByDay, weekday) {
+					rule.ByDay = append(rule.ByDay, weekday)
+				}
+			}
+		case "BYMONTHDAY":
+			for _, day := range strings.Split(value, ",") {
+				n, err := strconv.Atoi(day)
+				if err != nil || n == 0 || n < -31 || n > 31 {
+					return Rule{}, fmt.Errorf("invalid BYMONTHDAY value %q", day)
+				}
+				if !slices.Contains(rule.ByMonthDay, n) {
+					rule.ByMonthDay = append(rule.ByMonthDay, n)
+				}
+			}
+		default:
+			return Rule{}, fmt.Errorf("unsupported rule part %s", key)
+		}
+	}
+
+	switch {
+	case rule.Freq == "":
+		return Rule{}, fmt.Errorf("missing FREQ")
+	case rule.Count > 0 && rule.Until != nil:
+		return Rule{}, fmt.Errorf("COUNT and UNTIL cannot be combined")
+	case len(rule.ByDay) > 0 && rule.Freq != Weekly:
+		return Rule{}, fmt.Errorf("BYDAY is only supported with FREQ=WEEKLY")
+	case len(rule.ByMonthDay) > 0 && rule.Freq != Monthly:
+		return Rule{}, fmt.Errorf("BYMONTHDAY is only supported with FREQ=MONTHLY")
+	}
+	slices.SortFunc(rule.ByDay, func(a, b time.Weekday) int { return mondayFirst(a) - mondayFirst(b) })
+	return rule, nil
+}
+
+func parseUntil(value string) (time.Time, error) {
+	for _, layout := range []string{"20060102T150405Z", "20060102"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			if layout == "20060102" {
+				// A date-only UNTIL includes the whole day.
+				t = t.Add(24*time.Hour - time.Second)
+			}
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid UNTIL %q", value)
+}
+
+// String formats r as an RRULE value. Parse(r.String()) returns r.
+func (r Rule) String() string {
+	parts := []string{"FREQ=" + string(r.Freq)}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, weekday := range r.ByDay {
+			days[i] = strings.ToUpper(weekday.String()[:2])
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		days := make([]string, len(r.ByMonthDay))
+		for i, day := range r.ByMonthDay {
+			days[i] = strconv.Itoa(day)
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if r.Until != nil {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+	}
+	return strings.Join(parts, ";")
+}
+
+// Next returns the first occurrence after anchor, which is treated as the
+// first occurrence of the series. It returns false once the series has
+// ended because of UNTIL or because COUNT is 1.
+func (r Rule) Next(anchor time.Time) (time.Time, bool) {
+	if r.Count == 1 {
+		return time.Time{}, false
+	}
+	next, ok := r.next(anchor)
+	if !ok || (r.Until != nil && next.After(*r.Until)) {
+		return time.Time{}, false
+	}
+	return next, true
+}
+
+// Occurrences returns up to n occurrences following anchor.
+func (r Rule) Occurrences(anchor time.Time, n int) []time.Time {
+	var result []time.Time
+	for rule := r; len(result) < n; {
+		next, ok := rule.Next(anchor)
+		if !ok {
+			break
+		}
+		result = append(result, next)
+		anchor, rule = next, rule.Advance()
+	}
+	return result
+}
+
+// Advance returns the rule for the series that continues after the first
+// occurrence, which only differs from r if COUNT is set.
+func (r Rule) Advance() Rule {
+	if r.Count > 1 {
+		r.Count--
+	}
+	return r
+}
+
+// maxSteps bounds the search for rules that rarely match, such as
+// BYMONTHDAY=31 with a large INTERVAL.
+const maxSteps = 1000
+
+func (r Rule) next(t time.Time) (time.Time, bool) {
+	interval := max(r.Interval, 1)
+	at := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	}
+
+	switch r.Freq {
+	case Daily:
+		return t.AddDate(0, 0, interval), true
+
+	case Weekly:
+		if len(r.ByDay) == 0 {
+			return t.AddDate(0, 0, 7*interval), true
+		}
+		weekStart := at(t.Year(), t.Month(), t.Day()-mondayFirst(t.Weekday()))
+		for step := 0; step < maxSteps; step++ {
+			week := weekStart.AddDate(0, 0, 7*interval*step)
+			for _, weekday := range r.ByDay {
+				candidate := week.AddDate(0, 0, mondayFirst(weekday))
+				if candidate.After(t) {
+					return candidate, true
+				}
+			}
+		}
+
+	case Monthly:
+		days := r.ByMonthDay
+		if len(days) == 0 {
+			days = []int{t.Day()}
+		}
+		for step := 0; step < maxSteps; step++ {
+			first := time.Date(t.Year(), t.Month()+time.Month(interval*step), 1, 0, 0, 0, 0, t.Location())
+			length := daysIn(first.Year(), first.Month())
+			var candidates []time.Time
+			for _, day := range days {
+				if day < 0 {
+					day += length + 1
+				}
+				// Months without the requested day are skipped, as in RFC 5545.
+				if day < 1 || day > length {
+					continue
+				}
+				candidates = append(candidates, at(first.Year(), first.Month(), day))
+			}
+			slices.SortFunc(candidates, time.Time.Compare)
+			for _, candidate := range candidates {
+				if candidate.After(t) {
+					return candidate, true
+				}
+			}
+		}
+
+	case Yearly:
+		for step := 1; step < maxSteps; step++ {
+			year := t.Year() + interval*step
+			// February 29 only occurs in leap years.
+			if t.Day() <= daysIn(year, t.Month()) {
+				return at(year, t.Month(), t.Day()), true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+func mondayFirst(weekday time.Weekday) int {
+	return (int(weekday) + 6) % 7
+}
+
+func daysIn(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
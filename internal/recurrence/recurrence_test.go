@@ -0,0 +1,120 @@
+package recurrence
+
+import (
+	"testing"
+	"time"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 9, 30, 0, 0, time.UTC)
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"weekly", "FREQ=WEEKLY"},
+		{"Monthly", "FREQ=MONTHLY"},
+		{"RRULE:FREQ=DAILY;INTERVAL=3", "FREQ=DAILY;INTERVAL=3"},
+		{"FREQ=WEEKLY;BYDAY=FR,MO,MO", "FREQ=WEEKLY;BYDAY=MO,FR"},
+		{"freq=monthly;bymonthday=1,-1;count=12", "FREQ=MONTHLY;BYMONTHDAY=1,-1;COUNT=12"},
+		{"FREQ=YEARLY;UNTIL=20301231", "FREQ=YEARLY;UNTIL=20301231T235959Z"},
+	}
+	for _, tt := range tests {
+		rule, err := Parse(tt.in)
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %v", tt.in, err)
+			continue
+		}
+		if got := rule.String(); got != tt.want {
+			t.Errorf("Parse(%q).String() = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"hourly",
+		"INTERVAL=2",
+		"FREQ=HOURLY",
+		"FREQ=DAILY;INTERVAL=0",
+		"FREQ=DAILY;FREQ=WEEKLY",
+		"FREQ=DAILY;BYDAY=MO",
+		"FREQ=WEEKLY;BYDAY=1MO",
+		"FREQ=MONTHLY;BYMONTHDAY=32",
+		"FREQ=DAILY;COUNT=3;UNTIL=20300101",
+		"FREQ=DAILY;WKST=SU",
+		"FREQ=DAILY;UNTIL=tomorrow",
+	} {
+		if _, err := Parse(in); err == nil {
+			t.Errorf("Parse(%q) succeeded, want error", in)
+		}
+	}
+}
+
+func TestOccurrences(t *testing.T) {
+	tests := []struct {
+		rule   string
+		anchor time.Time
+		want   []time.Time
+	}{
+		{"daily", date(2025, 12, 30), []time.Time{date(2025, 12, 31), date(2026, 1, 1), date(2026, 1, 2)}},
+		{"FREQ=WEEKLY;INTERVAL=2", date(2025, 6, 2), []time.Time{date(2025, 6, 16), date(2025, 6, 30), date(2025, 7, 14)}},
+		// 2025-06-04 is a Wednesday.
+		{"FREQ=WEEKLY;BYDAY=MO,FR", date(2025, 6, 4), []time.Time{date(2025, 6, 6), date(2025, 6, 9), date(2025, 6, 13)}},
+		{"FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE", date(2025, 6, 4), []time.Time{date(2025, 6, 16), date(2025, 6, 18), date(2025, 6, 30)}},
+		// Months without a 31st are skipped.
+		{"monthly", date(2025, 1, 31), []time.Time{date(2025, 3, 31), date(2025, 5, 31), date(2025, 7, 31)}},
+		{"FREQ=MONTHLY;BYMONTHDAY=-1", date(2025, 1, 31), []time.Time{date(2025, 2, 28), date(2025, 3, 31), date(2025, 4, 30)}},
+		{"FREQ=MONTHLY;BYMONTHDAY=15,1", date(2025, 1, 10), []time.Time{date(2025, 1, 15), date(2025, 2, 1), date(2025, 2, 15)}},
+		{"yearly", date(2024, 2, 29), []time.Time{date(2028, 2, 29), date(2032, 2, 29), date(2036, 2, 29)}},
+		// The anchor counts as the first of three occurrences.
+		{"FREQ=DAILY;COUNT=3", date(2025, 6, 1), []time.Time{date(2025, 6, 2), date(2025, 6, 3)}},
+		{"FREQ=DAILY;UNTIL=20250603", date(2025, 6, 1), []time.Time{date(2025, 6, 2), date(2025, 6, 3)}},
+	}
+	for _, tt := range tests {
+		rule, err := Parse(tt.rule)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", tt.rule, err)
+		}
+		got := rule.Occurrences(tt.anchor, 3)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %d occurrences %v, want %v", tt.rule, len(got), got, tt.want)
+			continue
+		}
+		for i := range got {
+			if !got[i].Equal(tt.want[i]) {
+				t.Errorf("%s: occurrence %d = %v, want %v", tt.rule, i, got[i], tt.want[i])
+			}
+		}
+	}
+}
+
+func TestNextKeepsWallClockAcrossDST(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("time zone data unavailable: %v", err)
+	}
+	rule, _ := Parse("weekly")
+	anchor := time.Date(2025, 3, 27, 9, 0, 0, 0, berlin)
+
+	next, ok := rule.Next(anchor)
+	if !ok {
+		t.Fatal("expected a next occurrence")
+	}
+	if next.Hour() != 9 || next.Day() != 3 || next.Month() != time.April {
+		t.Errorf("expected 2025-04-03 09:00 local time, got %v", next)
+	}
+}
+
+func TestAdvance(t *testing.T) {
+	rule, _ := Parse("FREQ=DAILY;COUNT=2")
+	if _, ok := rule.Next(date(2025, 6, 1)); !ok {
+		t.Fatal("expected a next occurrence with COUNT=2")
+	}
+	if _, ok := rule.Advance().Next(date(2025, 6, 2)); ok {
+		t.Error("expected the series to end after advancing past the last occurrence")
+	}
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"encoding/json"
+	"go-todo/internal/database"
+	"go-todo/internal/models"
+	"log"
+	"net/http"
+	"time"
+)
+
+type archiveRequest struct {
+	// OlderThanDays archives the todos completed at least this many days ago.
+	OlderThanDays *int `json:"older_than_days"`
+}
+
+type archiveResponse struct {
+	Archived int64 `json:"archived"`
+}
+
+// @Summary Archive completed todos
+// @Description Archive every todo completed at least older_than_days days ago. Archived todos are
+// @Description left out of GET /todos unless include=archived is given, and are unarchived when reopened.
+// @Tags archive
+// @Accept json
+// @Produce json
+// @Param request body archiveRequest true "Age of the todos to archive"
+// @Success 200 {object} archiveResponse
+// @Failure 400 {object} problem "Invalid request"
+// @Router /todos/archive [post]
+func (s *Server) archiveTodosHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("POST %s from %s", r.URL.Path, r.RemoteAddr)
+	var req archiveRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		log.Printf("archiveTodosHandler: invalid request payload: %v", err)
+		writeError(w, r, err)
+		return
+	}
+
+	var v validator
+	v.check(req.OlderThanDays != nil, "older_than_days", "is required")
+	if req.OlderThanDays != nil {
+		v.check(*req.OlderThanDays >= 0, "older_than_days", "must not be negative")
+	}
+	if err := v.err(); err != nil {
+		log.Printf("archiveTodosHandler: invalid request: %v", err)
+		writeError(w, r, err)
+		return
+	}
+
+	archived, err := s.db.ArchiveCompletedTodos(r.Context(), time.Now().AddDate(0, 0, -*req.OlderThanDays))
+	if err != nil {
+		log.Printf("archiveTodosHandler: failed to archive todos: %v", err)
+		writeError(w, r, err)
+		return
+	}
+
+	log.Printf("archiveTodosHandler: archived %d todos", archived)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(archiveResponse{Archived: archived}); err != nil {
+		log.Printf("archiveTodosHandler: failed to write response: %v", err)
+	}
+}
+
+// @Summary List archived todos
+// @Description List the archived todos a page at a time; accepts the same filters as GET /todos
+// @Tags archive
+// @Produce json
+// @Param sort query string false "Comma-separated sort fields (priority, due_at, created_at, title), prefix with - for descending"
+// @Param limit query int false "Page size (default 50, max 500)"
+// @Param cursor query string false "Cursor of the page to fetch, taken from X-Next-Cursor"
+// @Success 200 {array} models.Todo
+// @Header 200 {string} X-Next-Cursor "Cursor of the next page, absent on the last page"
+// @Header 200 {string} Link "URL of the next page with rel=next"
+// @Failure 400 {object} problem "Invalid request"
+// @Router /archive [get]
+func (s *Server) getArchiveHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("GET %s from %s", r.URL.Path, r.RemoteAddr)
+	filter, err := parseTodoFilter(r)
+	if err != nil {
+		log.Printf("getArchiveHandler: invalid filter: %v", err)
+		writeError(w, r, badRequest(err))
+		return
+	}
+	filter.Archived = database.ArchivedOnly
+
+	limit, cursor, paged, err := parsePage(r)
+	if err != nil {
+		log.Printf("getArchiveHandler: invalid page: %v", err)
+		writeError(w, r, badRequest(err))
+		return
+	}
+	if !paged {
+		limit = defaultPageSize
+	}
+
+	page, err := s.db.GetTodoPage(r.Context(), filter, limit, cursor)
+	if err != nil {
+		log.Printf("getArchiveHandler: failed to fetch archived todos: %v", err)
+		writeError(w, r, err)
+		return
+	}
+	if page.Next != "" {
+		setNextPage(w, r, page.Next)
+	}
+	todos := page.Todos
+	if todos == nil {
+		todos = []models.Todo{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(todos); err != nil {
+		log.Printf("getArchiveHandler: failed to write response: %v", err)
+	}
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"encoding/json"
+	"go-todo/internal/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestArchiveHandlers(t *testing.T) {
+	s := newTestServer(t)
+	handler := s.RegisterRoutes()
+
+	createTestTodo(s, models.Todo{Title: "Done", Completed: true})
+	createTestTodo(s, models.Todo{Title: "Later"})
+	createTestTodo(s, models.Todo{Title: "Open"})
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+	ids := func(w *httptest.ResponseRecorder) []int {
+		t.Helper()
+		var todos []models.Todo
+		if err := json.NewDecoder(w.Body).Decode(&todos); err != nil {
+			t.Fatalf("failed to decode todos: %v", err)
+		}
+		var ids []int
+		for _, todo := range todos {
+			ids = append(ids, todo.ID)
+		}
+		return ids
+	}
+
+	archive := func(body string) int64 {
+		t.Helper()
+		w := do(http.MethodPost, "/todos/archive", body)
+		var resp archiveResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d %+v: %v", w.Code, resp, err)
+		}
+		return resp.Archived
+	}
+
+	if n := archive(`{"older_than_days": 7}`); n != 0 {
+		t.Errorf("expected todos completed today to be kept, got %d archived", n)
+	}
+	if n := archive(`{"older_than_days": 0}`); n != 1 {
+		t.Fatalf("expected one todo to be archived, got %d", n)
+	}
+	if got := ids(do(http.MethodGet, "/todos?sort=title", "")); len(got) != 2 {
+		t.Errorf("expected the archived todo to be left out, got %v", got)
+	}
+	if got := ids(do(http.MethodGet, "/todos?include=archived", "")); len(got) != 3 {
+		t.Errorf("expected every todo with include=archived, got %v", got)
+	}
+
+	w := do(http.MethodGet, "/archive", "")
+	if got := ids(w); len(got) != 1 || got[0] != 1 || w.Header().Get("X-Next-Cursor") != "" {
+		t.Errorf("expected a single page with the archived todo, got %v", got)
+	}
+
+	do(http.MethodPatch, "/todos/2", `{"completed": true}`)
+	archive(`{"older_than_days": 0}`)
+	w = do(http.MethodGet, "/archive?limit=1", "")
+	if got := ids(w); len(got) != 1 || got[0] != 1 || w.Header().Get("X-Next-Cursor") == "" {
+		t.Errorf("expected the first of two pages, got %v", got)
+	}
+
+	// Reopening a todo takes it out of the archive.
+	do(http.MethodPatch, "/todos/1", `{"completed": false}`)
+	if got := ids(do(http.MethodGet, "/archive", "")); len(got) != 1 || got[0] != 2 {
+		t.Errorf("expected the reopened todo to leave the archive, got %v", got)
+	}
+}
+
+func TestArchiveHandlersInvalid(t *testing.T) {
+	s := newTestServer(t)
+	handler := s.RegisterRoutes()
+
+	tests := []struct {
+		method, path, body string
+	}{
+		{http.MethodPost, "/todos/archive", `{}`},
+		{http.MethodPost, "/todos/archive", `{"older_than_days": -1}`},
+		{http.MethodGet, "/todos?include=deleted", ""},
+		{http.MethodGet, "/archive?limit=0", ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s %s %s: expected status 400, got %d", tt.method, tt.path, tt.body, w.Code)
+		}
+	}
+}
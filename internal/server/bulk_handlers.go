@@ -0,0 +1,245 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"go-todo/internal/database"
+	"go-todo/internal/models"
+	"log"
+	"net/http"
+	"slices"
+)
+
+// maxBulkOperations limits the number of operations in a single batch.
+const maxBulkOperations = 100
+
+// bulkMode decides what happens to a batch when one of its operations fails.
+type bulkMode string
+
+const (
+	// bulkAtomic applies either every operation of a batch or none. It is
+	// the default.
+	bulkAtomic bulkMode = "atomic"
+	// bulkBestEffort applies every operation that succeeds.
+	bulkBestEffort bulkMode = "best_effort"
+)
+
+type bulkRequest struct {
+	Mode       bulkMode        `json:"mode" enums:"atomic,best_effort"`
+	Operations []bulkOperation `json:"operations"`
+}
+
+type bulkOperation struct {
+	Op string `json:"op" enums:"create,update,complete,delete"`
+	// ID is the todo to update, complete or delete.
+	ID int `json:"id,omitempty"`
+	// Version, if set, must match the todo's current version, like If-Match.
+	Version int `json:"version,omitempty"`
+	// Todo is the todo to create.
+	Todo *newTodo `json:"todo,omitempty"`
+	// Patch is a JSON merge patch with the fields to update.
+	Patch json.RawMessage `json:"patch,omitempty" swaggertype:"object"`
+}
+
+// bulkResult is the outcome of the operation at the same index of a batch.
+type bulkResult struct {
+	Status int          `json:"status"`
+	Todo   *models.Todo `json:"todo,omitempty"`
+	Error  *problem     `json:"error,omitempty"`
+}
+
+type bulkResponse struct {
+	Results []bulkResult `json:"results"`
+}
+
+// @Summary Apply a batch of todo operations
+// @Description Create, update (with a JSON merge patch), complete and delete up to 100 todos in a
+// @Description single transaction. In atomic mode, the default, one failed operation rolls back the
+// @Description whole batch; in best_effort mode the other operations are applied regardless. Every
+// @Description operation reports its own status; the response is 207 if any of them failed.
+// @Tags todos
+// @Accept json
+// @Produce json
+// @Param batch body bulkRequest true "Operations"
+// @Success 200 {object} bulkResponse "Every operation succeeded"
+// @Success 207 {object} bulkResponse "Some operations failed"
+// @Failure 400 {object} problem "Invalid request"
+// @Router /todos/bulk [post]
+func (s *Server) bulkTodosHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("POST %s from %s", r.URL.Path, r.RemoteAddr)
+	var req bulkRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		log.Printf("bulkTodosHandler: invalid request payload: %v", err)
+		writeError(w, r, err)
+		return
+	}
+
+	var v validator
+	req.Mode = cmp.Or(req.Mode, bulkAtomic)
+	v.check(req.Mode == bulkAtomic || req.Mode == bulkBestEffort, "mode", "must be atomic or best_effort")
+	v.check(len(req.Operations) > 0, "operations", "must not be empty")
+	v.check(len(req.Operations) <= maxBulkOperations, "operations", "must not contain more than %d operations", maxBulkOperations)
+	if err := v.err(); err != nil {
+		log.Printf("bulkTodosHandler: invalid batch: %v", err)
+		writeError(w, r, err)
+		return
+	}
+
+	var results []bulkResult
+	fail := func(i int, err error) {
+		p := newProblem(r, err)
+		if p.Status >= http.StatusInternalServerError {
+			log.Printf("bulkTodosHandler: operation %d failed: %v", i, err)
+		}
+		results[i] = bulkResult{Status: p.Status, Error: &p}
+	}
+
+	// The operations are prepared and applied in one transaction, so that no
+	// todo changes in between.
+	ctx := r.Context()
+	err := s.db.WithTx(ctx, s.txIsolation, func(tx database.Store) error {
+		results = make([]bulkResult, len(req.Operations))
+
+		// Every operation is prepared, and validated, against the state of
+		// its todo before the batch, so a todo may only be changed once per
+		// batch.
+		var ops []database.TodoOperation
+		var indexes []int
+		changed := make(map[int]int)
+		for i, op := range req.Operations {
+			if op.ID != 0 {
+				if prev, ok := changed[op.ID]; ok {
+					fail(i, invalidField("id", "is already changed by operation %d", prev))
+					continue
+				}
+				changed[op.ID] = i
+			}
+
+			dbOp, err := s.prepareBulkOperation(ctx, tx, op)
+			if err != nil {
+				fail(i, bulkError(err))
+				continue
+			}
+			ops = append(ops, dbOp)
+			indexes = append(indexes, i)
+		}
+
+		atomic := req.Mode == bulkAtomic
+		if len(indexes) < len(req.Operations) && atomic {
+			for _, i := range indexes {
+				fail(i, database.ErrRolledBack)
+			}
+			return nil
+		}
+		if len(ops) == 0 {
+			return nil
+		}
+
+		applied, err := tx.ApplyTodoOperations(ctx, ops, atomic)
+		if err != nil {
+			return err
+		}
+		for j, result := range applied {
+			i := indexes[j]
+			switch {
+			case result.Err != nil:
+				fail(i, bulkError(result.Err))
+			case ops[j].Kind == database.OperationCreate:
+				results[i] = bulkResult{Status: http.StatusCreated, Todo: &result.Todo}
+			case ops[j].Kind == database.OperationDelete:
+				results[i] = bulkResult{Status: http.StatusNoContent}
+			default:
+				results[i] = bulkResult{Status: http.StatusOK, Todo: &result.Todo}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("bulkTodosHandler: failed to apply operations: %v", err)
+		writeError(w, r, err)
+		return
+	}
+
+	status := http.StatusOK
+	if slices.ContainsFunc(results, func(result bulkResult) bool { return result.Error != nil }) {
+		status = http.StatusMultiStatus
+	}
+	log.Printf("bulkTodosHandler: processed %d operations with status %d", len(results), status)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(bulkResponse{Results: results}); err != nil {
+		log.Printf("bulkTodosHandler: failed to write response: %v", err)
+	}
+}
+
+// prepareBulkOperation validates op and turns it into the write to perform
+// within tx, applying the same rules as the single-todo routes.
+func (s *Server) prepareBulkOperation(ctx context.Context, tx database.Store, op bulkOperation) (database.TodoOperation, error) {
+	if op.Op == "create" {
+		if op.Todo == nil {
+			return database.TodoOperation{}, invalidField("todo", "is required")
+		}
+		todo, err := op.Todo.todo()
+		return database.TodoOperation{Kind: database.OperationCreate, Todo: todo}, err
+	}
+
+	if op.ID <= 0 {
+		return database.TodoOperation{}, invalidField("id", "must be a positive integer")
+	}
+	switch op.Op {
+	case "delete":
+		return database.TodoOperation{Kind: database.OperationDelete, Todo: models.Todo{ID: op.ID, Version: op.Version}}, nil
+	case "update", "complete":
+	default:
+		return database.TodoOperation{}, invalidField("op", "must be one of create, update, complete or delete")
+	}
+
+	todo, err := tx.GetTodo(ctx, op.ID)
+	if err != nil {
+		return database.TodoOperation{}, err
+	}
+	if op.Version != 0 && op.Version != todo.Version {
+		return database.TodoOperation{}, errPreconditionFailed
+	}
+	wasCompleted := todo.Completed
+
+	fields := []string{"completed"}
+	if op.Op == "complete" {
+		todo.Completed = true
+	} else {
+		if op.Patch == nil {
+			return database.TodoOperation{}, invalidField("patch", "is required")
+		}
+		if fields, err = applyMergePatch(&todo, op.Patch); err != nil {
+			return database.TodoOperation{}, err
+		}
+		if err := validatePatchedTodo(&todo, fields); err != nil {
+			return database.TodoOperation{}, err
+		}
+	}
+
+	dbOp := database.TodoOperation{Kind: database.OperationPatch, Todo: todo, Fields: fields}
+	if !wasCompleted && todo.Completed {
+		if dbOp.Next, dbOp.CompleteSubtasks, err = s.completeTodo(&dbOp.Todo); err != nil {
+			return database.TodoOperation{}, err
+		}
+		if dbOp.Next != nil && !slices.Contains(dbOp.Fields, "recurrence") {
+			dbOp.Fields = append(dbOp.Fields, "recurrence")
+		}
+	}
+	return dbOp, nil
+}
+
+// bulkError maps the failure of a batch operation to the error reported for it.
+func bulkError(err error) error {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return notFound("Todo")
+	case errors.Is(err, database.ErrInvalidReference):
+		return errUnknownProjectOrParent
+	}
+	return err
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"go-todo/internal/models"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestBulkTodosHandler(t *testing.T) {
+	s := newTestServer(t)
+	handler := s.RegisterRoutes()
+	createTestTodo(s, models.Todo{Title: "Planning", Completed: false})
+	createTestTodo(s, models.Todo{Title: "Retro", Completed: false})
+	createTestTodo(s, models.Todo{Title: "Demo", Completed: false})
+
+	bulk := func(body string) (int, []int, bulkResponse) {
+		req := httptest.NewRequest(http.MethodPost, "/todos/bulk", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		var resp bulkResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("failed to decode response to %s: %v", body, err)
+		}
+		var statuses []int
+		for _, result := range resp.Results {
+			statuses = append(statuses, result.Status)
+		}
+		return w.Code, statuses, resp
+	}
+
+	code, statuses, resp := bulk(`{"operations": [
+		{"op": "create", "todo": {"title": "Sprint review", "completed": false}},
+		{"op": "complete", "id": 1},
+		{"op": "update", "id": 2, "patch": {"priority": 3}},
+		{"op": "delete", "id": 3, "version": 1}
+	]}`)
+	if code != http.StatusOK || !slices.Equal(statuses, []int{201, 200, 200, 204}) {
+		t.Fatalf("expected every operation to succeed, got %d %v", code, statuses)
+	}
+	if resp.Results[0].Todo.ID != 4 || !getTestTodo(t, s, 1).Completed || getTestTodo(t, s, 2).Priority != 3 || countTestTodos(t, s) != 3 {
+		t.Errorf("unexpected todos after the batch: %+v", resp.Results)
+	}
+
+	// A failed operation rolls back the whole atomic batch.
+	code, statuses, resp = bulk(`{"operations": [{"op": "update", "id": 2, "patch": {"priority": 1}}, {"op": "delete", "id": 42}]}`)
+	if code != http.StatusMultiStatus || !slices.Equal(statuses, []int{424, 404}) || resp.Results[0].Error.Code != "not_applied" {
+		t.Errorf("expected the batch to be rolled back, got %d %v", code, statuses)
+	}
+	if priority := getTestTodo(t, s, 2).Priority; priority != 3 {
+		t.Errorf("expected the update to be rolled back, got priority %d", priority)
+	}
+
+	// Invalid operations are reported without touching the database.
+	code, statuses, resp = bulk(`{"operations": [{"op": "delete", "id": 4}, {"op": "create", "todo": {"title": " ", "completed": false}}]}`)
+	if code != http.StatusMultiStatus || !slices.Equal(statuses, []int{424, 400}) || resp.Results[1].Error.Errors[0].Field != "title" {
+		t.Errorf("expected the invalid todo to fail the batch, got %d %v", code, statuses)
+	}
+	if _, err := s.db.GetTodo(context.Background(), 4); err != nil {
+		t.Errorf("expected todo 4 to survive the failed batch")
+	}
+
+	code, statuses, _ = bulk(`{"mode": "best_effort", "operations": [
+		{"op": "update", "id": 2, "patch": {"priority": 1}},
+		{"op": "delete", "id": 42},
+		{"op": "complete", "id": 2},
+		{"op": "complete", "id": 4, "version": 7}
+	]}`)
+	if code != http.StatusMultiStatus || !slices.Equal(statuses, []int{200, 404, 400, 412}) {
+		t.Errorf("expected only the valid operations to succeed, got %d %v", code, statuses)
+	}
+	if getTestTodo(t, s, 2).Priority != 1 || getTestTodo(t, s, 4).Completed {
+		t.Errorf("unexpected todos after the best effort batch")
+	}
+}
+
+func TestBulkTodosHandlerInvalid(t *testing.T) {
+	s := newTestServer(t)
+	for _, body := range []string{
+		`{"operations": []}`,
+		`{"mode": "sometimes", "operations": [{"op": "delete", "id": 1}]}`,
+		`{"operations": [{"op": "delete", "id": 1, "force": true}]}`,
+		`{"operations": [` + strings.Repeat(`{"op": "delete", "id": 1},`, maxBulkOperations) + `{"op": "delete", "id": 1}]}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/todos/bulk", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		s.bulkTodosHandler(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400 for %.60s, got %d", body, w.Code)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"fmt"
+	"go-todo/internal/models"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+var errPreconditionFailed = &apiError{http.StatusPreconditionFailed, "precondition_failed", "Todo was modified by another request", nil}
+
+// todoETag returns the entity tag of todo, which changes whenever its
+// representation does. The version only changes when the todo itself is
+// written, so the progress and the tag names, which change with writes to its
+// subtasks and tags, are hashed into the tag as well.
+func todoETag(todo models.Todo) string {
+	h := fnv.New64a()
+	if todo.Progress != nil {
+		fmt.Fprintf(h, "%d", *todo.Progress)
+	}
+	for _, tag := range slices.Sorted(slices.Values(todo.Tags)) {
+		h.Write([]byte{0})
+		io.WriteString(h, tag)
+	}
+	return fmt.Sprintf(`"%d-%x"`, todo.Version, h.Sum64())
+}
+
+// etagMatches reports whether header, the value of an If-Match or If-None-Match
+// header, lists etag or is "*". Weak tags only match when weak is set, as
+// If-Match requires the strong comparison and If-None-Match the weak one.
+func etagMatches(header, etag string, weak bool) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if weak {
+			tag = strings.TrimPrefix(tag, "W/")
+		}
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// staleTodoError reports that a write was based on an outdated version of a
+// todo. It is answered with 412 Precondition Failed and the todo's current
+// ETag.
+type staleTodoError struct {
+	etag string
+}
+
+func (e *staleTodoError) Error() string {
+	return errPreconditionFailed.Error()
+}
+
+func (e *staleTodoError) Unwrap() error {
+	return errPreconditionFailed
+}
+
+// checkIfMatch returns nil if a write to todo may proceed, i.e. if r carries
+// no If-Match header or one that matches the todo's current ETag, and a
+// *staleTodoError otherwise.
+func checkIfMatch(r *http.Request, todo models.Todo) error {
+	header := r.Header.Get("If-Match")
+	if header == "" || etagMatches(header, todoETag(todo), false) {
+		return nil
+	}
+	return &staleTodoError{etag: todoETag(todo)}
+}
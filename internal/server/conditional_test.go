@@ -0,0 +1,150 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"go-todo/internal/database"
+	"go-todo/internal/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// txCounter counts the transactions run on a database.
+type txCounter struct {
+	database.DBService
+	transactions int
+}
+
+func (c *txCounter) WithTx(ctx context.Context, isolation sql.IsolationLevel, fn func(tx database.Store) error) error {
+	c.transactions++
+	return c.DBService.WithTx(ctx, isolation, fn)
+}
+
+func TestEtagMatches(t *testing.T) {
+	tests := []struct {
+		header string
+		weak   bool
+		want   bool
+	}{
+		{`"3"`, false, true},
+		{`"2", "3"`, false, true},
+		{`*`, false, true},
+		{`"2"`, false, false},
+		{`W/"3"`, false, false},
+		{`W/"3"`, true, true},
+		{`"33"`, true, false},
+	}
+	for _, tt := range tests {
+		if got := etagMatches(tt.header, `"3"`, tt.weak); got != tt.want {
+			t.Errorf("etagMatches(%q, weak=%v) = %v, want %v", tt.header, tt.weak, got, tt.want)
+		}
+	}
+}
+
+func TestTodoConditionalRequests(t *testing.T) {
+	s := newTestServer(t)
+	db := &txCounter{DBService: s.db}
+	s.db = db
+	handler := s.RegisterRoutes()
+	created := createTestTodo(s, models.Todo{Title: "Report", Description: "Quarterly"})
+
+	do := func(method, body string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/todos/1", strings.NewReader(body))
+		req.Header = header
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodGet, "", http.Header{})
+	first := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || !strings.HasPrefix(first, `"1-`) {
+		t.Fatalf("expected status 200 with an ETag of version 1, got %d %q", w.Code, first)
+	}
+	w = do(http.MethodGet, "", http.Header{"If-None-Match": {"W/" + first}})
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("expected status 304 without a body, got %d", w.Code)
+	}
+
+	update := `{"title": "Report", "description": "Quarterly", "completed": true}`
+	w = do(http.MethodPut, update, http.Header{"If-Match": {first}})
+	second := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || !strings.HasPrefix(second, `"2-`) {
+		t.Fatalf("expected status 200 with an ETag of version 2, got %d %q", w.Code, second)
+	}
+
+	// The first ETag is outdated now, so every write based on it fails.
+	w = do(http.MethodPatch, `{"completed": false}`, http.Header{"If-Match": {first}})
+	if w.Code != http.StatusPreconditionFailed || w.Header().Get("ETag") != second {
+		t.Errorf("expected status 412 with the current ETag, got %d %q", w.Code, w.Header().Get("ETag"))
+	}
+	if p := decodeProblem(t, w); p.Code != "precondition_failed" {
+		t.Errorf("unexpected problem %+v", p)
+	}
+	w = do(http.MethodDelete, "", http.Header{"If-Match": {first}})
+	if w.Code != http.StatusPreconditionFailed {
+		t.Errorf("expected status 412, got %d", w.Code)
+	}
+	w = do(http.MethodGet, "", http.Header{"If-None-Match": {first}})
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status 200 for a changed todo, got %d", w.Code)
+	}
+
+	w = do(http.MethodDelete, "", http.Header{"If-Match": {"*"}})
+	if w.Code != http.StatusNoContent {
+		t.Errorf("expected status 204, got %d", w.Code)
+	}
+	if created.Version != 1 {
+		t.Errorf("expected the created todo to have version 1, got %d", created.Version)
+	}
+	// The If-Match check and the write it guards share a transaction.
+	if db.transactions != 4 {
+		t.Errorf("expected every write to run in a transaction, got %d transactions", db.transactions)
+	}
+}
+
+func TestTodoETagFollowsSubtasksAndTags(t *testing.T) {
+	s := newTestServer(t)
+	handler := s.RegisterRoutes()
+	parent := createTestTodo(s, models.Todo{Title: "Release", Tags: []string{"ops"}})
+	child := createTestTodo(s, models.Todo{Title: "Changelog", ParentID: &parent.ID})
+
+	get := func(etag string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/todos/1", nil)
+		req.Header.Set("If-None-Match", etag)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	etag := get("").Header().Get("ETag")
+	if w := get(etag); w.Code != http.StatusNotModified {
+		t.Fatalf("expected status 304 for an unchanged todo, got %d", w.Code)
+	}
+
+	// Completing the subtask changes the parent's progress, not its version.
+	if w := patchTestTodo(s, child.ID, `{"completed": true}`); w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	w := get(etag)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 after the subtask changed, got %d", w.Code)
+	}
+	etag = w.Header().Get("ETag")
+
+	// Renaming a tag changes the parent's tags, not its version.
+	tag, err := s.db.GetTags(context.Background())
+	if err != nil || len(tag) != 1 {
+		t.Fatalf("failed to get tags: %v", err)
+	}
+	tag[0].Name = "operations"
+	if err := s.db.UpdateTag(context.Background(), &tag[0]); err != nil {
+		t.Fatalf("UpdateTag failed: %v", err)
+	}
+	if w := get(etag); w.Code != http.StatusOK {
+		t.Errorf("expected status 200 after the tag was renamed, got %d", w.Code)
+	}
+}
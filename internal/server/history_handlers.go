@@ -0,0 +1,88 @@
+package server
+
+import (
+	"encoding/json"
+	"go-todo/internal/database"
+	"go-todo/internal/models"
+	"log"
+	"net/http"
+)
+
+// @Summary Get the history of a todo
+// @Description List the revisions of a todo, newest first, with snapshots of the todo before and
+// @Description after each write and the fields it changed. Renaming or deleting a tag is recorded
+// @Description as a write of the todos carrying it. The API has no user identity, so changed_by
+// @Description is null for writes made through it.
+// @Tags history
+// @Produce json
+// @Param id path int true "Todo ID"
+// @Success 200 {array} models.TodoRevision
+// @Failure 400 {object} problem "Invalid request"
+// @Failure 404 {object} problem "Todo not found"
+// @Router /todos/{id}/history [get]
+func (s *Server) getTodoHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("GET %s from %s", r.URL.Path, r.RemoteAddr)
+	id, err := parsePathID(r, "id")
+	if err != nil {
+		log.Printf("getTodoHistoryHandler: invalid ID: %v", err)
+		writeError(w, r, badRequest(err))
+		return
+	}
+
+	revisions, err := s.db.GetTodoHistory(r.Context(), id)
+	if err != nil {
+		log.Printf("getTodoHistoryHandler: failed to fetch history of todo with id %d: %v", id, err)
+		writeError(w, r, lookupError("Todo", err))
+		return
+	}
+	if revisions == nil {
+		revisions = []models.TodoRevision{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(revisions); err != nil {
+		log.Printf("getTodoHistoryHandler: failed to write response: %v", err)
+	}
+}
+
+// @Summary Revert a todo
+// @Description Restore the fields and tags a todo had at a past version. The revert is an update
+// @Description of its own and is recorded as a new revision.
+// @Tags history
+// @Produce json
+// @Param id path int true "Todo ID"
+// @Param version path int true "Version to revert to"
+// @Param If-Match header string false "ETag the revert is based on"
+// @Success 200 {object} models.Todo
+// @Failure 400 {object} problem "Invalid request"
+// @Failure 404 {object} problem "Todo or revision not found"
+// @Failure 409 {object} problem "Todo has open subtasks"
+// @Failure 412 {object} problem "Todo was modified since the If-Match ETag"
+// @Router /todos/{id}/history/{version}/revert [post]
+func (s *Server) revertTodoHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("POST %s from %s", r.URL.Path, r.RemoteAddr)
+	id, err := parsePathID(r, "id")
+	if err != nil {
+		log.Printf("revertTodoHandler: invalid ID: %v", err)
+		writeError(w, r, badRequest(err))
+		return
+	}
+	version, err := parsePathID(r, "version")
+	if err != nil {
+		log.Printf("revertTodoHandler: invalid version: %v", err)
+		writeError(w, r, badRequest(err))
+		return
+	}
+
+	s.saveTodo(w, r, "revertTodoHandler", id, func(tx database.Store, todo *models.Todo) ([]string, error) {
+		revision, err := tx.GetTodoRevision(r.Context(), id, version)
+		if err != nil {
+			return nil, lookupError("Revision", err)
+		}
+		past := revision.After
+		todo.Title, todo.Description, todo.Completed, todo.Priority = past.Title, past.Description, past.Completed, past.Priority
+		todo.StartAt, todo.DueAt, todo.Recurrence = past.StartAt, past.DueAt, past.Recurrence
+		todo.ProjectID, todo.ParentID, todo.Tags = past.ProjectID, past.ParentID, past.Tags
+		return nil, nil
+	})
+}
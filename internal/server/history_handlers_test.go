@@ -0,0 +1,78 @@
+package server
+
+import (
+	"encoding/json"
+	"go-todo/internal/models"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestTodoHistoryHandlers(t *testing.T) {
+	s := newTestServer(t)
+	handler := s.RegisterRoutes()
+	createTestTodo(s, models.Todo{Title: "Draft", Tags: []string{"writing"}})
+
+	do := func(method, path, body string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	stale := do(http.MethodGet, "/todos/1", "", nil).Header().Get("ETag")
+	w := do(http.MethodPatch, "/todos/1", `{"title": "Final", "tags": ["done"]}`, http.Header{"X-Request-Id": {"req-patch"}})
+	current := w.Header().Get("ETag")
+
+	w = do(http.MethodGet, "/todos/1/history", "", nil)
+	var history []models.TodoRevision
+	if err := json.NewDecoder(w.Body).Decode(&history); err != nil {
+		t.Fatalf("failed to decode history: %v", err)
+	}
+	if len(history) != 2 || history[0].Operation != "update" || history[1].Operation != "create" {
+		t.Fatalf("expected an update and a create, newest first, got %+v", history)
+	}
+	if history[0].Before == nil || history[0].Before.Title != "Draft" || history[0].After.Title != "Final" {
+		t.Errorf("unexpected snapshots %+v", history[0])
+	}
+	// The request ID is chosen by the client, so it is not taken for who made the write.
+	if history[0].ChangedBy != nil {
+		t.Errorf("expected no actor, got %q", *history[0].ChangedBy)
+	}
+
+	// Stale ETags are refused like for any other update.
+	if w := do(http.MethodPost, "/todos/1/history/1/revert", "", http.Header{"If-Match": {stale}}); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("expected status 412, got %d", w.Code)
+	}
+	w = do(http.MethodPost, "/todos/1/history/1/revert", "", http.Header{"If-Match": {current}})
+	var reverted models.Todo
+	if err := json.NewDecoder(w.Body).Decode(&reverted); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %v", w.Code, err)
+	}
+	if reverted.Title != "Draft" || !slices.Equal(reverted.Tags, []string{"writing"}) || reverted.Version != 3 {
+		t.Errorf("expected the first version with a new version number, got %+v", reverted)
+	}
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/todos/1/history/9/revert", http.StatusNotFound},
+		{"/todos/2/history/1/revert", http.StatusNotFound},
+		{"/todos/1/history/x/revert", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if w := do(http.MethodPost, tt.path, "", nil); w.Code != tt.want {
+			t.Errorf("POST %s: expected status %d, got %d", tt.path, tt.want, w.Code)
+		}
+	}
+	if w := do(http.MethodGet, "/todos/2/history", "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for the history of a missing todo, got %d", w.Code)
+	}
+}
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"go-todo/internal/database"
+	"io"
+	"log"
+	"net/http"
+)
+
+// replayedHeaders are the response headers stored with an idempotent
+// response; the middleware in front of the route sets the others again.
+var replayedHeaders = []string{"Content-Type", "ETag", "Location"}
+
+var (
+	errInvalidIdempotencyKey = &apiError{http.StatusBadRequest, "invalid_idempotency_key", "Idempotency-Key must be 1 to 255 visible ASCII characters", nil}
+	errIdempotencyKeyInUse   = &apiError{http.StatusConflict, "idempotency_key_in_use", "A request with this Idempotency-Key is still in progress", nil}
+	errIdempotencyKeyReused  = &apiError{http.StatusUnprocessableEntity, "idempotency_key_reused", "Idempotency-Key was already used for a different request", nil}
+)
+
+// idempotent makes a mutating route safe to retry. The first request with a
+// given Idempotency-Key header is handled by next and its response stored;
+// retries of the same request replay that response instead of repeating the
+// write. Reusing a key for a different request fails with 422. Requests
+// without the header are passed through unchanged.
+func (s *Server) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" {
+			next(w, r)
+			return
+		}
+		if len(key) > 255 || !visibleASCII(key) {
+			writeError(w, r, errInvalidIdempotencyKey)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+		if err != nil {
+			log.Printf("idempotent: failed to read request body: %v", err)
+			writeError(w, r, payloadError(err))
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		hash := requestHash(r, body)
+
+		record, err := s.db.ReserveIdempotencyKey(r.Context(), key, hash, cmp.Or(s.idempotencyTTL, defaultIdempotencyTTL))
+		if err != nil {
+			log.Printf("idempotent: failed to reserve idempotency key %q: %v", key, err)
+			writeError(w, r, err)
+			return
+		}
+		switch {
+		case record == nil:
+		case record.RequestHash != hash:
+			writeError(w, r, errIdempotencyKeyReused)
+			return
+		case record.Status == 0:
+			writeError(w, r, errIdempotencyKeyInUse)
+			return
+		default:
+			log.Printf("idempotent: replaying response for idempotency key %q", key)
+			for name, value := range record.Header {
+				w.Header().Set(name, value)
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(record.Status)
+			if _, err := w.Write(record.Body); err != nil {
+				log.Printf("idempotent: failed to write response: %v", err)
+			}
+			return
+		}
+
+		// The key is released or completed even if the client has gone away
+		// in the meantime, so that it is not left reserved.
+		ctx := context.WithoutCancel(r.Context())
+		release := func() {
+			if err := s.db.ReleaseIdempotencyKey(ctx, key); err != nil {
+				log.Printf("idempotent: failed to release idempotency key %q: %v", key, err)
+			}
+		}
+
+		// If next panics, the key is released before the panic goes on to
+		// net/http, as retries would be refused as in progress until the key
+		// expires otherwise.
+		returned := false
+		defer func() {
+			if !returned {
+				release()
+			}
+		}()
+		rec := &responseCapture{ResponseWriter: w}
+		next(rec, r)
+		returned = true
+		status := cmp.Or(rec.status, http.StatusOK)
+
+		// Server errors are not stored so that the client can retry them.
+		if status >= http.StatusInternalServerError {
+			release()
+			return
+		}
+		stored := database.IdempotencyRecord{Key: key, RequestHash: hash, Status: status, Header: map[string]string{}, Body: rec.body.Bytes()}
+		for _, name := range replayedHeaders {
+			if value := w.Header().Get(name); value != "" {
+				stored.Header[name] = value
+			}
+		}
+		if err := s.db.CompleteIdempotencyKey(ctx, stored); err != nil {
+			log.Printf("idempotent: failed to store response for idempotency key %q: %v", key, err)
+		}
+	}
+}
+
+// requestHash identifies a request by its method, path and body.
+func requestHash(r *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+r.URL.Path+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// responseCapture records the status and body written through it.
+type responseCapture struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (c *responseCapture) WriteHeader(status int) {
+	if c.status == 0 {
+		c.status = status
+	}
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *responseCapture) Write(b []byte) (int, error) {
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	c.body.Write(b)
+	return c.ResponseWriter.Write(b)
+}
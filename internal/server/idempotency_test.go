@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIdempotentCreate(t *testing.T) {
+	s := newTestServer(t)
+	handler := s.RegisterRoutes()
+
+	post := func(key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/todos", strings.NewReader(body))
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	body := `{"title": "Groceries", "completed": false}`
+	first := post("retry-1", body)
+	if first.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", first.Code, first.Body.String())
+	}
+	retry := post("retry-1", body)
+	if retry.Code != http.StatusCreated || retry.Body.String() != first.Body.String() {
+		t.Errorf("expected the first response to be replayed, got %d: %s", retry.Code, retry.Body.String())
+	}
+	if retry.Header().Get("Idempotent-Replayed") != "true" || retry.Header().Get("ETag") != first.Header().Get("ETag") {
+		t.Errorf("expected replayed headers, got %v", retry.Header())
+	}
+	if n := countTestTodos(t, s); n != 1 {
+		t.Fatalf("expected the retry not to create another todo, got %d todos", n)
+	}
+
+	w := post("retry-1", `{"title": "Something else", "completed": false}`)
+	if w.Code != http.StatusUnprocessableEntity || decodeProblem(t, w).Code != "idempotency_key_reused" {
+		t.Errorf("expected status 422 for a reused key, got %d", w.Code)
+	}
+
+	// Validation failures are stored like any other response.
+	if w := post("retry-2", `{"completed": false}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", w.Code)
+	}
+	if w := post("retry-2", `{"completed": false}`); w.Code != http.StatusBadRequest || w.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("expected the validation error to be replayed, got %d", w.Code)
+	}
+
+	hash := requestHash(httptest.NewRequest(http.MethodPost, "/todos", nil), []byte(body))
+	if _, err := s.db.ReserveIdempotencyKey(context.Background(), "pending", hash, time.Hour); err != nil {
+		t.Fatalf("failed to reserve key: %v", err)
+	}
+	if w := post("pending", body); w.Code != http.StatusConflict {
+		t.Errorf("expected status 409 while the first request is in progress, got %d", w.Code)
+	}
+
+	if w := post("bad key", body); w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an invalid key, got %d", w.Code)
+	}
+	post("", body)
+	post("", body)
+	if n := countTestTodos(t, s); n != 3 {
+		t.Errorf("expected requests without a key to create todos, got %d todos", n)
+	}
+}
+
+func TestIdempotentPanic(t *testing.T) {
+	s := newTestServer(t)
+	calls := 0
+	handler := s.idempotent(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			panic("boom")
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	post := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/todos", strings.NewReader(`{"title": "Groceries"}`))
+		req.Header.Set("Idempotency-Key", "panic-1")
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("expected the panic to reach the caller")
+			}
+		}()
+		post()
+	}()
+	if w := post(); w.Code != http.StatusCreated || calls != 2 {
+		t.Errorf("expected the retry to be handled, got status %d after %d calls", w.Code, calls)
+	}
+}
+
+func TestParseIdempotencyTTL(t *testing.T) {
+	for value, want := range map[string]time.Duration{"": defaultIdempotencyTTL, "1h": time.Hour, "-1h": defaultIdempotencyTTL, "soon": defaultIdempotencyTTL} {
+		if got := parseIdempotencyTTL(value); got != want {
+			t.Errorf("parseIdempotencyTTL(%q) = %v, want %v", value, got, want)
+		}
+	}
+}
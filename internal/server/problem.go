@@ -0,0 +1,148 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-todo/internal/database"
+	"log"
+	"net/http"
+)
+
+const problemContentType = "application/problem+json"
+
+// problem is an RFC 7807 problem details response body.
+type problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	// Code identifies the kind of problem for clients, e.g. "not_found".
+	Code string `json:"code"`
+	// Errors lists the offending fields of a failed validation.
+	Errors    []fieldError `json:"errors,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+}
+
+// fieldError describes why a single request field or parameter is invalid.
+type fieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// apiError is an error that is reported to the client as a problem with the
+// given status and code.
+type apiError struct {
+	status int
+	code   string
+	detail string
+	fields []fieldError
+}
+
+func (e *apiError) Error() string {
+	return e.detail
+}
+
+var (
+	errInvalidPayload         = &apiError{http.StatusBadRequest, "invalid_payload", "Invalid request payload", nil}
+	errOpenSubtasks           = &apiError{http.StatusConflict, "open_subtasks", "Todo has open subtasks", nil}
+	errTagExists              = &apiError{http.StatusConflict, "tag_exists", "Tag already exists", nil}
+	errUnknownProjectOrParent = &apiError{http.StatusBadRequest, "invalid_reference", "Project or parent todo not found", nil}
+	errNotApplied             = &apiError{http.StatusFailedDependency, "not_applied", "Not applied because another operation of the batch failed", nil}
+	errInternal               = &apiError{http.StatusInternalServerError, "internal_error", "Internal server error", nil}
+	errTxConflict             = &apiError{http.StatusConflict, "concurrent_update", "The request conflicted with concurrent requests; retry it", nil}
+	errTimeout                = &apiError{http.StatusServiceUnavailable, "timeout", "The request took too long to process", nil}
+	errCanceled               = &apiError{http.StatusServiceUnavailable, "canceled", "The request was canceled", nil}
+)
+
+// notFound reports that the named resource, such as "Todo", does not exist.
+func notFound(resource string) *apiError {
+	return &apiError{http.StatusNotFound, "not_found", resource + " not found", nil}
+}
+
+// lookupError reports a failed lookup of the named resource: not found if it
+// does not exist, or err itself otherwise.
+func lookupError(resource string, err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return notFound(resource)
+	}
+	return err
+}
+
+// badRequest reports err as an invalid request. Errors that already carry a
+// problem, such as validation errors, are returned unchanged.
+func badRequest(err error) *apiError {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	return &apiError{http.StatusBadRequest, "bad_request", err.Error(), nil}
+}
+
+// invalidField reports a single invalid request field or parameter.
+func invalidField(field, format string, args ...any) *apiError {
+	message := fmt.Sprintf(format, args...)
+	return &apiError{http.StatusBadRequest, "validation_failed", field + " " + message, []fieldError{{field, message}}}
+}
+
+// problemFor maps err to the problem reported to the client. Database errors
+// without a more specific meaning become an opaque internal error.
+func problemFor(err error) *apiError {
+	var apiErr *apiError
+	switch {
+	case errors.As(err, &apiErr):
+		return apiErr
+	case errors.Is(err, sql.ErrNoRows):
+		return notFound("Resource")
+	case errors.Is(err, database.ErrConflict):
+		return &apiError{http.StatusConflict, "conflict", "A conflicting record already exists", nil}
+	case errors.Is(err, database.ErrInvalidReference):
+		return &apiError{http.StatusBadRequest, "invalid_reference", "Referenced record not found", nil}
+	case errors.Is(err, database.ErrCycle):
+		return &apiError{http.StatusBadRequest, "cycle", "A todo cannot be a subtask of itself or of its subtasks", nil}
+	case errors.Is(err, database.ErrVersionMismatch):
+		return errPreconditionFailed
+	case errors.Is(err, database.ErrRolledBack):
+		return errNotApplied
+	case errors.Is(err, database.ErrTxConflict):
+		return errTxConflict
+	case errors.Is(err, database.ErrInvalidCursor):
+		return &apiError{http.StatusBadRequest, "invalid_cursor", "Invalid cursor", nil}
+	case errors.Is(err, context.DeadlineExceeded):
+		return errTimeout
+	case errors.Is(err, context.Canceled):
+		return errCanceled
+	}
+	return errInternal
+}
+
+// newProblem returns the problem describing err as a failure of r.
+func newProblem(r *http.Request, err error) problem {
+	apiErr := problemFor(err)
+	return problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(apiErr.status),
+		Status:    apiErr.status,
+		Detail:    apiErr.detail,
+		Code:      apiErr.code,
+		Errors:    apiErr.fields,
+		RequestID: requestID(r.Context()),
+	}
+}
+
+// writeError responds to r with the problem describing err.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	body := newProblem(r, err)
+	var stale *staleTodoError
+	if errors.As(err, &stale) {
+		w.Header().Set("ETag", stale.etag)
+	}
+	w.Header().Set("Content-Type", problemContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(body.Status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("writeError: failed to write response: %v", err)
+	}
+}
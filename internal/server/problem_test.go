@@ -0,0 +1,121 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-todo/internal/database"
+	"go-todo/internal/models"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func decodeProblem(t *testing.T, w *httptest.ResponseRecorder) problem {
+	t.Helper()
+	if ct := w.Header().Get("Content-Type"); ct != problemContentType {
+		t.Fatalf("expected Content-Type %q, got %q", problemContentType, ct)
+	}
+	var p problem
+	if err := json.NewDecoder(w.Body).Decode(&p); err != nil {
+		t.Fatalf("failed to decode problem: %v", err)
+	}
+	return p
+}
+
+func TestWriteError(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{sql.ErrNoRows, http.StatusNotFound, "not_found"},
+		{fmt.Errorf("wrapped: %w", sql.ErrNoRows), http.StatusNotFound, "not_found"},
+		{lookupError("Todo", sql.ErrNoRows), http.StatusNotFound, "not_found"},
+		{database.ErrConflict, http.StatusConflict, "conflict"},
+		{database.ErrInvalidReference, http.StatusBadRequest, "invalid_reference"},
+		{database.ErrCycle, http.StatusBadRequest, "cycle"},
+		{database.ErrInvalidCursor, http.StatusBadRequest, "invalid_cursor"},
+		{fmt.Errorf("update: %w", database.ErrTxConflict), http.StatusConflict, "concurrent_update"},
+		{badRequest(errors.New("bad filter")), http.StatusBadRequest, "bad_request"},
+		{invalidField("priority", "must be between 0 and 4"), http.StatusBadRequest, "validation_failed"},
+		{fmt.Errorf("query todos: %w", context.DeadlineExceeded), http.StatusServiceUnavailable, "timeout"},
+		{context.Canceled, http.StatusServiceUnavailable, "canceled"},
+		{errors.New("connection refused"), http.StatusInternalServerError, "internal_error"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/todos/1", nil)
+		w := httptest.NewRecorder()
+		writeError(w, req, tt.err)
+
+		if w.Code != tt.status {
+			t.Errorf("%v: expected status %d, got %d", tt.err, tt.status, w.Code)
+		}
+		p := decodeProblem(t, w)
+		if p.Status != tt.status || p.Code != tt.code || p.Title != http.StatusText(tt.status) {
+			t.Errorf("%v: unexpected problem %+v", tt.err, p)
+		}
+	}
+}
+
+func TestWriteErrorHidesInternalDetails(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/todos", nil)
+	w := httptest.NewRecorder()
+	writeError(w, req, errors.New(`pq: relation "todos" does not exist`))
+
+	if strings.Contains(w.Body.String(), "relation") {
+		t.Errorf("expected database error to be hidden, got %s", w.Body.String())
+	}
+}
+
+func TestProblemResponses(t *testing.T) {
+	s := newTestServer(t)
+	handler := s.RegisterRoutes()
+
+	do := func(method, path, body string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	// A missing todo is reported as such rather than as a server error.
+	w := do(http.MethodGet, "/todos/42", "", http.Header{"X-Request-Id": {"req-123"}})
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %d", w.Code)
+	}
+	p := decodeProblem(t, w)
+	if p.Code != "not_found" || p.Detail != "Todo not found" || p.RequestID != "req-123" {
+		t.Errorf("unexpected problem %+v", p)
+	}
+	if got := w.Header().Get("X-Request-ID"); got != "req-123" {
+		t.Errorf("expected the request ID to be echoed, got %q", got)
+	}
+
+	w = do(http.MethodPost, "/todos", `{"title": " ", "priority": 1}`, nil)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", w.Code)
+	}
+	p = decodeProblem(t, w)
+	want := []fieldError{{"completed", "is required"}, {"title", "is required"}}
+	if p.Code != "validation_failed" || !reflect.DeepEqual(p.Errors, want) {
+		t.Errorf("expected missing field details, got %+v", p)
+	}
+	if p.RequestID == "" || p.RequestID != w.Header().Get("X-Request-ID") {
+		t.Errorf("expected a generated request ID, got %q and header %q", p.RequestID, w.Header().Get("X-Request-ID"))
+	}
+
+	created := createTestTodo(s, models.Todo{Title: "Report", Description: "Quarterly"})
+	w = do(http.MethodPut, fmt.Sprintf("/todos/%d", created.ID), `{"title": "Report", "description": "Quarterly", "completed": false, "priority": 7}`, nil)
+	p = decodeProblem(t, w)
+	if w.Code != http.StatusBadRequest || !reflect.DeepEqual(p.Errors, []fieldError{{"priority", "must be between 0 and 4"}}) {
+		t.Errorf("expected priority field error, got %d %+v", w.Code, p)
+	}
+}
@@ -0,0 +1,278 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-todo/internal/database"
+	"go-todo/internal/models"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// @Summary Get all projects
+// @Description Get all projects
+// @Tags projects
+// @Produce json
+// @Success 200 {array} models.Project
+// @Router /projects [get]
+func (s *Server) getProjectsHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("GET %s from %s", r.URL.Path, r.RemoteAddr)
+	projects, err := s.db.GetProjects(r.Context())
+	if err != nil {
+		log.Printf("getProjectsHandler: failed to fetch projects: %v", err)
+		writeError(w, r, err)
+		return
+	}
+	if projects == nil {
+		projects = []models.Project{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(projects); err != nil {
+		log.Printf("getProjectsHandler: failed to write response: %v", err)
+	}
+}
+
+// @Summary Get a project by ID
+// @Description Get a project by ID
+// @Tags projects
+// @Produce json
+// @Param id path int true "Project ID"
+// @Success 200 {object} models.Project
+// @Router /projects/{id} [get]
+func (s *Server) getProjectHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("GET %s from %s", r.URL.Path, r.RemoteAddr)
+	id, err := parsePathID(r, "id")
+	if err != nil {
+		log.Printf("getProjectHandler: invalid ID: %v", err)
+		writeError(w, r, badRequest(err))
+		return
+	}
+
+	project, err := s.db.GetProject(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, r, notFound("Project"))
+		return
+	}
+	if err != nil {
+		log.Printf("getProjectHandler: failed to fetch project with id %d: %v", id, err)
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(project); err != nil {
+		log.Printf("getProjectHandler: failed to write response: %v", err)
+	}
+}
+
+// @Summary Get the todos of a project
+// @Description Get the todos of a project; accepts the same filters as GET /todos
+// @Tags projects
+// @Produce json
+// @Param id path int true "Project ID"
+// @Success 200 {array} models.Todo
+// @Router /projects/{id}/todos [get]
+func (s *Server) getProjectTodosHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("GET %s from %s", r.URL.Path, r.RemoteAddr)
+	id, err := parsePathID(r, "id")
+	if err != nil {
+		log.Printf("getProjectTodosHandler: invalid ID: %v", err)
+		writeError(w, r, badRequest(err))
+		return
+	}
+
+	filter, err := parseTodoFilter(r)
+	if err != nil {
+		log.Printf("getProjectTodosHandler: invalid filter: %v", err)
+		writeError(w, r, badRequest(err))
+		return
+	}
+	filter.ProjectID = &id
+
+	if _, err := s.db.GetProject(r.Context(), id); err != nil {
+		log.Printf("getProjectTodosHandler: failed to fetch project with id %d: %v", id, err)
+		writeError(w, r, lookupError("Project", err))
+		return
+	}
+
+	todos, err := s.db.GetTodos(r.Context(), filter)
+	if err != nil {
+		log.Printf("getProjectTodosHandler: failed to fetch todos: %v", err)
+		writeError(w, r, err)
+		return
+	}
+	if todos == nil {
+		todos = []models.Todo{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(todos); err != nil {
+		log.Printf("getProjectTodosHandler: failed to write response: %v", err)
+	}
+}
+
+type projectPayload struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// @Summary Create project
+// @Description Create a new project
+// @Tags projects
+// @Accept json
+// @Produce json
+// @Param project body projectPayload true "Project"
+// @Success 201 {object} models.Project
+// @Router /projects [post]
+func (s *Server) createProjectHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("POST %s from %s", r.URL.Path, r.RemoteAddr)
+	var payload projectPayload
+	if err := decodeJSON(w, r, &payload); err != nil {
+		log.Printf("createProjectHandler: invalid request payload: %v", err)
+		writeError(w, r, err)
+		return
+	}
+
+	project := models.Project{Name: payload.Name, Description: payload.Description}
+	if err := validateProject(&project); err != nil {
+		log.Printf("createProjectHandler: invalid project: %v", err)
+		writeError(w, r, err)
+		return
+	}
+
+	if err := s.db.CreateProject(r.Context(), &project); err != nil {
+		log.Printf("createProjectHandler: failed to create project: %v", err)
+		writeError(w, r, err)
+		return
+	}
+
+	log.Printf("createProjectHandler: created project with id %d", project.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(project); err != nil {
+		log.Printf("createProjectHandler: failed to write response: %v", err)
+	}
+}
+
+// @Summary Update project
+// @Description Update an existing project
+// @Tags projects
+// @Accept json
+// @Produce json
+// @Param id path int true "Project ID"
+// @Param project body projectPayload true "Project"
+// @Success 200 {object} models.Project
+// @Router /projects/{id} [put]
+func (s *Server) updateProjectHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("PUT %s from %s", r.URL.Path, r.RemoteAddr)
+	id, err := parsePathID(r, "id")
+	if err != nil {
+		log.Printf("updateProjectHandler: invalid ID: %v", err)
+		writeError(w, r, badRequest(err))
+		return
+	}
+
+	var payload projectPayload
+	if err := decodeJSON(w, r, &payload); err != nil {
+		log.Printf("updateProjectHandler: invalid request payload: %v", err)
+		writeError(w, r, err)
+		return
+	}
+
+	project := models.Project{ID: id, Name: payload.Name, Description: payload.Description}
+	if err := validateProject(&project); err != nil {
+		log.Printf("updateProjectHandler: invalid project: %v", err)
+		writeError(w, r, err)
+		return
+	}
+
+	err = s.db.UpdateProject(r.Context(), &project)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, r, notFound("Project"))
+		return
+	}
+	if err != nil {
+		log.Printf("updateProjectHandler: failed to update project with id %d: %v", id, err)
+		writeError(w, r, err)
+		return
+	}
+
+	log.Printf("updateProjectHandler: updated project with id %d", id)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(project); err != nil {
+		log.Printf("updateProjectHandler: failed to write response: %v", err)
+	}
+}
+
+// @Summary Delete project
+// @Description Delete a project. Its todos are removed from the project by default,
+// @Description moved to the trash with todos=delete, or moved to another project with todos=reassign.
+// @Description Restoring a todo deleted with its project brings the project back.
+// @Tags projects
+// @Param id path int true "Project ID"
+// @Param todos query string false "What happens to the project's todos (default unassign)" Enums(unassign, delete, reassign)
+// @Param reassign_to query int false "Project receiving the todos when todos=reassign"
+// @Success 204
+// @Router /projects/{id} [delete]
+func (s *Server) deleteProjectHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("DELETE %s from %s", r.URL.Path, r.RemoteAddr)
+	id, err := parsePathID(r, "id")
+	if err != nil {
+		log.Printf("deleteProjectHandler: invalid ID: %v", err)
+		writeError(w, r, badRequest(err))
+		return
+	}
+
+	how, err := parseProjectDeletion(r)
+	if err != nil {
+		log.Printf("deleteProjectHandler: %v", err)
+		writeError(w, r, badRequest(err))
+		return
+	}
+
+	err = s.db.DeleteProject(r.Context(), id, how)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		writeError(w, r, notFound("Project"))
+		return
+	case errors.Is(err, database.ErrInvalidReference):
+		writeError(w, r, invalidField("reassign_to", "must be an existing project"))
+		return
+	case err != nil:
+		log.Printf("deleteProjectHandler: failed to delete project with id %d: %v", id, err)
+		writeError(w, r, err)
+		return
+	}
+
+	log.Printf("deleteProjectHandler: deleted project with id %d", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func parseProjectDeletion(r *http.Request) (database.ProjectDeletion, error) {
+	var how database.ProjectDeletion
+	q := r.URL.Query()
+
+	switch q.Get("todos") {
+	case "", "unassign":
+	case "delete":
+		how.Cascade = true
+	case "reassign":
+		target, err := strconv.Atoi(q.Get("reassign_to"))
+		if err != nil {
+			return how, fmt.Errorf("todos=reassign requires a valid reassign_to project ID")
+		}
+		how.ReassignTo = &target
+		return how, nil
+	default:
+		return how, fmt.Errorf("invalid todos value %q", q.Get("todos"))
+	}
+
+	if q.Has("reassign_to") {
+		return how, fmt.Errorf("reassign_to requires todos=reassign")
+	}
+	return how, nil
+}
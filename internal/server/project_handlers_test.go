@@ -0,0 +1,146 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"go-todo/internal/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProjectHandlers(t *testing.T) {
+	s := newTestServer(t)
+	handler := s.RegisterRoutes()
+
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	// Create
+	w := do(http.MethodPost, "/projects", `{"name":"Website","description":"Relaunch"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d", w.Code)
+	}
+	var created models.Project
+	if err := json.NewDecoder(w.Body).Decode(&created); err != nil {
+		t.Fatalf("could not decode response: %v", err)
+	}
+	if created.Name != "Website" || created.CreatedAt.IsZero() {
+		t.Errorf("unexpected project: %+v", created)
+	}
+
+	if w := do(http.MethodPost, "/projects", `{"description":"No name"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for missing name, got %d", w.Code)
+	}
+
+	// Update
+	w = do(http.MethodPut, "/projects/1", `{"name":"Website v2","description":"Relaunch"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	if w := do(http.MethodPut, "/projects/42", `{"name":"Missing"}`); w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for unknown project, got %d", w.Code)
+	}
+
+	// Get
+	w = do(http.MethodGet, "/projects/1", "")
+	var got models.Project
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatalf("could not decode response: %v", err)
+	}
+	if got.Name != "Website v2" {
+		t.Errorf("expected updated name, got %q", got.Name)
+	}
+
+	// Todos of a project
+	projectID := created.ID
+	yesterday, tomorrow := time.Now().AddDate(0, 0, -1), time.Now().AddDate(0, 0, 1)
+	overdue := createTestTodo(s, models.Todo{Title: "Design", Description: "Mockups", ProjectID: &projectID, DueAt: &yesterday})
+	createTestTodo(s, models.Todo{Title: "Copy", Description: "Texts", ProjectID: &projectID, DueAt: &tomorrow})
+	createTestTodo(s, models.Todo{Title: "Taxes", Description: "Elsewhere", DueAt: &yesterday})
+	w = do(http.MethodGet, "/projects/1/todos?due=overdue", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	var todos []models.Todo
+	if err := json.NewDecoder(w.Body).Decode(&todos); err != nil {
+		t.Fatalf("could not decode response: %v", err)
+	}
+	if len(todos) != 1 || todos[0].ID != overdue.ID {
+		t.Errorf("expected only the overdue todo of the project, got %+v", todos)
+	}
+	if w := do(http.MethodGet, "/projects/42/todos", ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for unknown project, got %d", w.Code)
+	}
+}
+
+func TestCreateTodoHandlerUnknownProject(t *testing.T) {
+	s := newTestServer(t)
+	body := `{"title":"Design","description":"Mockups","completed":false,"project_id":42}`
+	req := httptest.NewRequest(http.MethodPost, "/todo/create", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	s.createTodoHandler(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", w.Code)
+	}
+}
+
+func TestDeleteProjectHandler(t *testing.T) {
+	tests := []struct {
+		query       string
+		wantStatus  int
+		wantTodo    bool
+		wantProject *int
+	}{
+		{"", http.StatusNoContent, true, nil},
+		{"?todos=delete", http.StatusNoContent, false, nil},
+		{"?todos=reassign&reassign_to=2", http.StatusNoContent, true, intPtr(2)},
+		{"?todos=reassign&reassign_to=99", http.StatusBadRequest, true, intPtr(1)},
+		{"?todos=reassign", http.StatusBadRequest, true, intPtr(1)},
+		{"?reassign_to=2", http.StatusBadRequest, true, intPtr(1)},
+		{"?todos=archive", http.StatusBadRequest, true, intPtr(1)},
+	}
+	for _, tt := range tests {
+		s := newTestServer(t)
+		for _, name := range []string{"Old", "New"} {
+			if err := s.db.CreateProject(context.Background(), &models.Project{Name: name}); err != nil {
+				t.Fatalf("CreateProject failed: %v", err)
+			}
+		}
+		todo := createTestTodo(s, models.Todo{Title: "Task", Description: "Desc", ProjectID: intPtr(1)})
+
+		req := httptest.NewRequest(http.MethodDelete, "/projects/1"+tt.query, nil)
+		w := httptest.NewRecorder()
+		s.RegisterRoutes().ServeHTTP(w, req)
+
+		if w.Code != tt.wantStatus {
+			t.Errorf("%q: expected status %d, got %d", tt.query, tt.wantStatus, w.Code)
+			continue
+		}
+		remaining, err := s.db.GetTodo(context.Background(), todo.ID)
+		if ok := err == nil; ok != tt.wantTodo {
+			t.Errorf("%q: expected todo to exist=%t, got %t", tt.query, tt.wantTodo, ok)
+			continue
+		}
+		if err == nil && !equalIntPtr(remaining.ProjectID, tt.wantProject) {
+			t.Errorf("%q: expected project_id %v, got %v", tt.query, tt.wantProject, remaining.ProjectID)
+		}
+	}
+}
+
+func intPtr(v int) *int { return &v }
+
+func equalIntPtr(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
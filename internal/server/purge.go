@@ -0,0 +1,29 @@
+package server
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// purgeTrash permanently deletes the todos that have been in the trash for
+// longer than the retention period, once right away and then at every
+// interval, until ctx is done.
+func (s *Server) purgeTrash(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		purged, err := s.db.PurgeTrash(ctx, time.Now().Add(-s.trashRetention))
+		if err != nil {
+			log.Printf("purgeTrash: failed to purge trash: %v", err)
+		} else if purged > 0 {
+			log.Printf("purgeTrash: purged %d todos deleted more than %v ago", purged, s.trashRetention)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
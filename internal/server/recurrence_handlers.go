@@ -0,0 +1,124 @@
+package server
+
+import (
+	"encoding/json"
+	"go-todo/internal/models"
+	"go-todo/internal/recurrence"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultOccurrences = 5
+	maxOccurrences     = 100
+)
+
+// recurrenceLocation is the location whose wall clock recurring todos follow,
+// the server's as set by TZ, so that a daily todo due at 9:00 stays due at
+// 9:00 across daylight saving changes. Due dates are stored as instants, so
+// they are moved to it before the next occurrences are computed.
+var recurrenceLocation = time.Local
+
+// normalizeRecurrence validates a recurrence rule and returns it in its
+// canonical RRULE form. Recurring todos need a due date to anchor the series.
+func normalizeRecurrence(rule string, dueAt *time.Time) (string, error) {
+	if rule == "" {
+		return "", nil
+	}
+	parsed, err := recurrence.Parse(rule)
+	if err != nil {
+		return "", invalidField("recurrence", "is invalid: %v", err)
+	}
+	if dueAt == nil {
+		return "", invalidField("due_at", "is required for recurring todos")
+	}
+	return parsed.String(), nil
+}
+
+// nextOccurrence returns the todo that follows todo in its recurring series,
+// or false if the series has ended.
+func nextOccurrence(todo models.Todo) (models.Todo, bool) {
+	if todo.Recurrence == "" || todo.DueAt == nil {
+		return models.Todo{}, false
+	}
+	rule, err := recurrence.Parse(todo.Recurrence)
+	if err != nil {
+		return models.Todo{}, false
+	}
+	dueAt, ok := rule.Next(todo.DueAt.In(recurrenceLocation))
+	if !ok {
+		return models.Todo{}, false
+	}
+
+	next := models.Todo{
+		Title:       todo.Title,
+		Description: todo.Description,
+		Priority:    todo.Priority,
+		DueAt:       &dueAt,
+		Tags:        todo.Tags,
+		ProjectID:   todo.ProjectID,
+		ParentID:    todo.ParentID,
+		Recurrence:  rule.Advance().String(),
+	}
+	if todo.StartAt != nil {
+		startAt := dueAt.Add(todo.StartAt.Sub(*todo.DueAt))
+		next.StartAt = &startAt
+	}
+	return next, true
+}
+
+// @Summary Preview the next occurrences of a recurring todo
+// @Description List the due dates of the next occurrences of a recurring todo
+// @Tags todos
+// @Produce json
+// @Param id path int true "Todo ID"
+// @Param count query int false "Number of occurrences (default 5, max 100)"
+// @Success 200 {array} string
+// @Router /todos/{id}/occurrences [get]
+func (s *Server) getTodoOccurrencesHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("GET %s from %s", r.URL.Path, r.RemoteAddr)
+	id, err := parsePathID(r, "id")
+	if err != nil {
+		log.Printf("getTodoOccurrencesHandler: invalid ID: %v", err)
+		writeError(w, r, badRequest(err))
+		return
+	}
+
+	count := defaultOccurrences
+	if value := r.URL.Query().Get("count"); value != "" {
+		count, err = strconv.Atoi(value)
+		if err != nil || count < 1 || count > maxOccurrences {
+			writeError(w, r, invalidField("count", "must be between 1 and %d", maxOccurrences))
+			return
+		}
+	}
+
+	todo, err := s.db.GetTodo(r.Context(), id)
+	if err != nil {
+		log.Printf("getTodoOccurrencesHandler: failed to fetch todo with id %d: %v", id, err)
+		writeError(w, r, lookupError("Todo", err))
+		return
+	}
+	if todo.Recurrence == "" || todo.DueAt == nil {
+		writeError(w, r, &apiError{http.StatusBadRequest, "not_recurring", "Todo is not recurring", nil})
+		return
+	}
+
+	rule, err := recurrence.Parse(todo.Recurrence)
+	if err != nil {
+		log.Printf("getTodoOccurrencesHandler: stored recurrence of todo with id %d is invalid: %v", id, err)
+		writeError(w, r, err)
+		return
+	}
+	occurrences := rule.Occurrences(todo.DueAt.In(recurrenceLocation), count)
+	if occurrences == nil {
+		occurrences = []time.Time{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(occurrences); err != nil {
+		log.Printf("getTodoOccurrencesHandler: failed to write response: %v", err)
+	}
+}
@@ -1,10 +1,15 @@
 package server
 
 import (
+	"context"
+	"crypto/rand"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"slices"
+	"strings"
 
 	_ "go-todo/docs"
 
@@ -24,14 +29,130 @@ func (s *Server) RegisterRoutes() http.Handler {
 	}
 
 	// Todo routes
-	mux.HandleFunc("/todos", s.getTodosHandler)
-	mux.HandleFunc("/todo/", s.getTodoHandler)
-	mux.HandleFunc("/todo/create", s.createTodoHandler)
-	mux.HandleFunc("/todo/update/", s.updateTodoHandler)
-	mux.HandleFunc("/todo/delete/", s.deleteTodoHandler)
-
-	// Wrap the mux with CORS middleware
-	return s.corsMiddleware(mux)
+	mux.HandleFunc("GET /todos", s.getTodosHandler)
+	mux.HandleFunc("POST /todos", s.idempotent(s.createTodoHandler))
+	mux.HandleFunc("GET /todos/{id}", s.getTodoHandler)
+	mux.HandleFunc("PUT /todos/{id}", s.idempotent(s.updateTodoHandler))
+	mux.HandleFunc("PATCH /todos/{id}", s.idempotent(s.patchTodoHandler))
+	mux.HandleFunc("DELETE /todos/{id}", s.idempotent(s.deleteTodoHandler))
+	mux.HandleFunc("POST /todos/bulk", s.idempotent(s.bulkTodosHandler))
+	mux.HandleFunc("POST /todos/archive", s.idempotent(s.archiveTodosHandler))
+	mux.HandleFunc("GET /todos/search", s.searchTodosHandler)
+	mux.HandleFunc("GET /todos/{id}/children", s.getTodoChildrenHandler)
+	mux.HandleFunc("GET /todos/{id}/tree", s.getTodoTreeHandler)
+	mux.HandleFunc("GET /todos/{id}/occurrences", s.getTodoOccurrencesHandler)
+	mux.HandleFunc("POST /todos/{id}/restore", s.idempotent(s.restoreTodoHandler))
+	mux.HandleFunc("GET /todos/{id}/history", s.getTodoHistoryHandler)
+	mux.HandleFunc("POST /todos/{id}/history/{version}/revert", s.idempotent(s.revertTodoHandler))
+
+	// Requested with other methods, the literal paths below /todos would be
+	// taken for IDs by the /todos/{id} routes and refused as invalid IDs.
+	for path, allow := range map[string][]string{
+		"/todos/bulk":    {http.MethodPost},
+		"/todos/archive": {http.MethodPost},
+		"/todos/search":  {http.MethodGet, http.MethodHead},
+	} {
+		for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete} {
+			if !slices.Contains(allow, method) {
+				mux.HandleFunc(method+" "+path, methodNotAllowed(allow))
+			}
+		}
+	}
+
+	// Archive routes
+	mux.HandleFunc("GET /archive", s.getArchiveHandler)
+
+	// Trash routes
+	mux.HandleFunc("GET /trash", s.getTrashHandler)
+	mux.HandleFunc("DELETE /trash/{id}", s.idempotent(s.purgeTodoHandler))
+
+	// Tag routes
+	mux.HandleFunc("GET /tags", s.getTagsHandler)
+	mux.HandleFunc("POST /tags", s.idempotent(s.createTagHandler))
+	mux.HandleFunc("GET /tags/{id}", s.getTagHandler)
+	mux.HandleFunc("PUT /tags/{id}", s.idempotent(s.updateTagHandler))
+	mux.HandleFunc("DELETE /tags/{id}", s.idempotent(s.deleteTagHandler))
+
+	// Project routes
+	mux.HandleFunc("GET /projects", s.getProjectsHandler)
+	mux.HandleFunc("POST /projects", s.idempotent(s.createProjectHandler))
+	mux.HandleFunc("GET /projects/{id}", s.getProjectHandler)
+	mux.HandleFunc("PUT /projects/{id}", s.idempotent(s.updateProjectHandler))
+	mux.HandleFunc("DELETE /projects/{id}", s.idempotent(s.deleteProjectHandler))
+	mux.HandleFunc("GET /projects/{id}/todos", s.getProjectTodosHandler)
+
+	// Deprecated verb-in-path todo routes, kept for older clients
+	if s.legacyRoutes {
+		mux.HandleFunc("GET /todo/{id}", deprecated("/todos/{id}", s.getTodoHandler))
+		mux.HandleFunc("POST /todo/create", deprecated("/todos", s.idempotent(s.createTodoHandler)))
+		mux.HandleFunc("PUT /todo/update/{id}", deprecated("/todos/{id}", s.idempotent(s.updateTodoHandler)))
+		mux.HandleFunc("DELETE /todo/delete/{id}", deprecated("/todos/{id}", s.idempotent(s.deleteTodoHandler)))
+	}
+
+	// Wrap the mux with CORS and request ID middleware
+	return requestIDMiddleware(s.corsMiddleware(mux))
+}
+
+type requestIDKey struct{}
+
+// requestIDMiddleware tags every request with an ID, taken from the
+// X-Request-ID header if the client sent a usable one, and echoes it in the
+// response so errors can be correlated with logs. Clients choose the ID, so
+// it does not say who made a request.
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = rand.Text()
+		}
+		w.Header().Set("X-Request-ID", id)
+		ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func validRequestID(id string) bool {
+	return len(id) <= 128 && visibleASCII(id)
+}
+
+// visibleASCII reports whether s is non-empty and consists of printable ASCII
+// characters other than space only.
+func visibleASCII(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// requestID returns the ID assigned to the request by requestIDMiddleware.
+func requestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// deprecated marks the responses of a legacy route as deprecated and links to
+// the route replacing it, in which {id} is filled in from the request.
+func deprecated(successor string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		successor := strings.Replace(successor, "{id}", r.PathValue("id"), 1)
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="successor-version"`, successor))
+		next(w, r)
+	}
+}
+
+// methodNotAllowed refuses a request like the mux does when no route serves
+// its method, listing the methods that are served in the Allow header.
+func methodNotAllowed(allow []string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Allow", strings.Join(allow, ", "))
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
 }
 
 func (s *Server) corsMiddleware(next http.Handler) http.Handler {
@@ -39,7 +160,8 @@ func (s *Server) corsMiddleware(next http.Handler) http.Handler {
 		// Set CORS headers
 		w.Header().Set("Access-Control-Allow-Origin", "*") // Replace "*" with specific origins if needed
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS, PATCH")
-		w.Header().Set("Access-Control-Allow-Headers", "Accept, Authorization, Content-Type, X-CSRF-Token")
+		w.Header().Set("Access-Control-Allow-Headers", "Accept, Authorization, Content-Type, Idempotency-Key, If-Match, If-None-Match, X-CSRF-Token, X-Request-ID")
+		w.Header().Set("Access-Control-Expose-Headers", "ETag, Idempotent-Replayed, Link, X-Next-Cursor, X-Request-ID")
 		w.Header().Set("Access-Control-Allow-Credentials", "false") // Set to "true" if credentials are required
 
 		// Handle preflight OPTIONS requests
@@ -63,7 +185,7 @@ func (s *Server) PingHandler(w http.ResponseWriter, r *http.Request) {
 	resp := map[string]string{"message": "pong"}
 	jsonResp, err := json.Marshal(resp)
 	if err != nil {
-		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -79,9 +201,9 @@ func (s *Server) PingHandler(w http.ResponseWriter, r *http.Request) {
 // @Success: 200 {object} map[string]string
 // @Router: /health [get]
 func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) {
-	resp, err := json.Marshal(s.db.Health())
+	resp, err := json.Marshal(s.db.Health(r.Context()))
 	if err != nil {
-		http.Error(w, "Failed to marshal health check response", http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
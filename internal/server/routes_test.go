@@ -1,6 +1,9 @@
 package server
 
 import (
+	"context"
+	"database/sql"
+	"go-todo/internal/database"
 	"go-todo/internal/models"
 	"io"
 	"net/http"
@@ -9,21 +12,35 @@ import (
 	"testing"
 )
 
-type mockDBService struct {
-	health map[string]string
-	todos  map[int]models.Todo
-	nextID int
+// newTestServer returns a Server backed by a fresh in-memory database, which
+// is closed when the test ends.
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	db := database.NewMemory()
+	t.Cleanup(func() { db.Close() })
+	return &Server{db: db}
 }
 
-func newMockDBService() *mockDBService {
-	return &mockDBService{
-		todos:  make(map[int]models.Todo),
-		nextID: 1,
+// getTestTodo returns the stored todo with the given ID.
+func getTestTodo(t *testing.T, s *Server, id int) models.Todo {
+	t.Helper()
+	todo, err := s.db.GetTodo(context.Background(), id)
+	if err != nil {
+		t.Fatalf("failed to get todo %d: %v", id, err)
 	}
+	return todo
 }
 
-func (m *mockDBService) Health() map[string]string { return m.health }
-func (m *mockDBService) Close() error              { return nil }
+// countTestTodos returns the number of stored todos, archived or not, that
+// are not in the trash.
+func countTestTodos(t *testing.T, s *Server) int {
+	t.Helper()
+	todos, err := s.db.GetTodos(context.Background(), database.TodoFilter{Archived: database.ArchivedInclude})
+	if err != nil {
+		t.Fatalf("failed to get todos: %v", err)
+	}
+	return len(todos)
+}
 
 func TestPingHandler(t *testing.T) {
 	s := &Server{}
@@ -49,14 +66,7 @@ func TestPingHandler(t *testing.T) {
 }
 
 func TestHealthHandler(t *testing.T) {
-	// Mock a database service with a healthy response
-	mockDB := &mockDBService{
-		health: map[string]string{
-			"status":  "up",
-			"message": "It's healthy",
-		},
-	}
-	s := &Server{db: mockDB}
+	s := newTestServer(t)
 
 	req := httptest.NewRequest(http.MethodGet, "/health", nil)
 	w := httptest.NewRecorder()
@@ -72,7 +82,86 @@ func TestHealthHandler(t *testing.T) {
 
 	body, _ := io.ReadAll(resp.Body)
 	bodyStr := string(body)
-	if !strings.Contains(bodyStr, `"status":"up"`) || !strings.Contains(bodyStr, `"message":"It's healthy"`) {
+	if !strings.Contains(bodyStr, `"status":"up"`) || !strings.Contains(bodyStr, `"open_connections":"1"`) {
 		t.Errorf("unexpected body: %s", bodyStr)
 	}
 }
+
+func TestRoutesMethodNotAllowed(t *testing.T) {
+	s := newTestServer(t)
+	s.legacyRoutes = true
+	handler := s.RegisterRoutes()
+
+	tests := []struct {
+		method, path string
+		allow        string
+	}{
+		{http.MethodPost, "/todos/1", "DELETE, GET, HEAD, PATCH, PUT"},
+		{http.MethodDelete, "/todos", "GET, HEAD, POST"},
+		// Literal paths are not taken for todo IDs.
+		{http.MethodGet, "/todos/bulk", "POST"},
+		{http.MethodDelete, "/todos/archive", "POST"},
+		{http.MethodPatch, "/todos/search", "GET, HEAD"},
+		{http.MethodPost, "/todos/search", "GET, HEAD"},
+		// Legacy routes no longer act on any method.
+		{http.MethodGet, "/todo/delete/1", "DELETE"},
+		{http.MethodGet, "/todo/update/1", "PUT"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != http.StatusMethodNotAllowed {
+			t.Errorf("%s %s: expected status 405, got %d", tt.method, tt.path, w.Code)
+		}
+		if allow := w.Header().Get("Allow"); allow != tt.allow {
+			t.Errorf("%s %s: expected Allow %q, got %q", tt.method, tt.path, tt.allow, allow)
+		}
+	}
+}
+
+func TestLegacyRoutes(t *testing.T) {
+	s := newTestServer(t)
+	s.legacyRoutes = true
+	createTestTodo(s, models.Todo{Title: "Legacy", Description: "Old client"})
+
+	req := httptest.NewRequest(http.MethodGet, "/todo/1", nil)
+	w := httptest.NewRecorder()
+	s.RegisterRoutes().ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	if w.Header().Get("Deprecation") != "true" || w.Header().Get("Link") != `</todos/1>; rel="successor-version"` {
+		t.Errorf("expected deprecation headers, got %v", w.Header())
+	}
+
+	s.legacyRoutes = false
+	w = httptest.NewRecorder()
+	s.RegisterRoutes().ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 with legacy routes disabled, got %d", w.Code)
+	}
+}
+
+func TestParseTxIsolation(t *testing.T) {
+	for value, want := range map[string]sql.IsolationLevel{
+		"":                sql.LevelRepeatableRead,
+		"read_committed":  sql.LevelReadCommitted,
+		"serializable":    sql.LevelSerializable,
+		"snapshot":        sql.LevelRepeatableRead,
+		"repeatable_read": sql.LevelRepeatableRead,
+	} {
+		if got := parseTxIsolation(value); got != want {
+			t.Errorf("parseTxIsolation(%q) = %v, want %v", value, got, want)
+		}
+	}
+}
+
+func TestParseLegacyRoutes(t *testing.T) {
+	for value, want := range map[string]bool{"": true, "true": true, "1": true, "false": false, "0": false, "nope": true} {
+		if got := parseLegacyRoutes(value); got != want {
+			t.Errorf("parseLegacyRoutes(%q) = %v, want %v", value, got, want)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"encoding/json"
+	"go-todo/internal/database"
+	"go-todo/internal/models"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultSearchResults = 20
+	maxSearchResults     = 100
+)
+
+// @Summary Search todos
+// @Description Full-text search over todo titles and descriptions, best matches first.
+// @Description Words are matched after stemming, "quoted phrases" match consecutive words
+// @Description and a trailing * matches word prefixes. Every term has to match. Archived todos
+// @Description are left out unless include=archived is given. The highlights are HTML.
+// @Tags todos
+// @Produce json
+// @Param q query string true "Search query with words, quoted phrases and prefix* terms"
+// @Param limit query int false "Maximum number of results (default 20, max 100)"
+// @Param include query string false "Also search archived todos" Enums(archived)
+// @Success 200 {array} models.SearchResult
+// @Router /todos/search [get]
+func (s *Server) searchTodosHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("GET %s from %s", r.URL.Path, r.RemoteAddr)
+	search, err := database.ParseSearch(r.URL.Query().Get("q"))
+	if err != nil {
+		log.Printf("searchTodosHandler: invalid query: %v", err)
+		writeError(w, r, badRequest(err))
+		return
+	}
+	if search.Archived, err = parseInclude(r); err != nil {
+		writeError(w, r, badRequest(err))
+		return
+	}
+
+	limit := defaultSearchResults
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxSearchResults {
+			writeError(w, r, invalidField("limit", "must be between 1 and %d", maxSearchResults))
+			return
+		}
+	}
+
+	results, err := s.db.SearchTodos(r.Context(), search, limit)
+	if err != nil {
+		log.Printf("searchTodosHandler: failed to search todos: %v", err)
+		writeError(w, r, err)
+		return
+	}
+	if results == nil {
+		results = []models.SearchResult{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(results); err != nil {
+		log.Printf("searchTodosHandler: failed to write response: %v", err)
+	}
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"encoding/json"
+	"go-todo/internal/models"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestSearchTodosHandler(t *testing.T) {
+	s := newTestServer(t)
+	createTestTodo(s, models.Todo{Title: "Write release notes", Description: "For the deployment"})
+	createTestTodo(s, models.Todo{Title: "Deploy", Description: "Ship the release"})
+	createTestTodo(s, models.Todo{Title: "Groceries", Description: "Milk"})
+
+	tests := []struct {
+		query string
+		want  []int
+	}{
+		{"?q=release", []int{1, 2}},
+		{"?q=deploy*", []int{2, 1}},
+		{"?q=%22release+notes%22", []int{1}},
+		{"?q=release&limit=1", []int{1}},
+		{"?q=release+milk", []int{}},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/todos/search"+tt.query, nil)
+		w := httptest.NewRecorder()
+		s.searchTodosHandler(w, req)
+		if w.Code != http.StatusOK {
+			t.Errorf("%q: expected status 200, got %d", tt.query, w.Code)
+			continue
+		}
+
+		var results []models.SearchResult
+		if err := json.NewDecoder(w.Body).Decode(&results); err != nil {
+			t.Fatalf("%q: failed to decode response: %v", tt.query, err)
+		}
+		got := []int{}
+		for _, result := range results {
+			got = append(got, result.Todo.ID)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%q: expected todos %v, got %v", tt.query, tt.want, got)
+		}
+	}
+}
+
+func TestSearchTodosHandlerInvalid(t *testing.T) {
+	for _, query := range []string{"", "?q=", "?q=%22%22", "?q=*", "?q=x&limit=0", "?q=x&limit=101", "?q=x&include=deleted"} {
+		s := newTestServer(t)
+
+		req := httptest.NewRequest(http.MethodGet, "/todos/search"+query, nil)
+		w := httptest.NewRecorder()
+
+		s.searchTodosHandler(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%q: expected status 400, got %d", query, w.Code)
+		}
+	}
+}
@@ -1,7 +1,10 @@
 package server
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
+	"log"
 	"net/http"
 	"os"
 	"strconv"
@@ -16,6 +19,117 @@ type Server struct {
 	port int
 
 	db database.DBService
+
+	subtaskCompletion subtaskCompletion
+
+	// legacyRoutes keeps serving the deprecated /todo/create, /todo/update/{id}
+	// and /todo/delete/{id} style routes. It is configured with the
+	// LEGACY_ROUTES environment variable and enabled by default.
+	legacyRoutes bool
+
+	// idempotencyTTL is how long responses to requests with an
+	// Idempotency-Key are replayed. It is configured with the IDEMPOTENCY_TTL
+	// environment variable, such as "12h", and defaults to 24 hours.
+	idempotencyTTL time.Duration
+
+	// trashRetention is how long deleted todos stay in the trash before they
+	// are purged. It is configured with the TRASH_RETENTION environment
+	// variable, such as "168h", and defaults to 30 days; 0 keeps them forever.
+	trashRetention time.Duration
+
+	// txIsolation is the isolation level of the transactions in which
+	// handlers read a record and write it back. It is configured with the
+	// TX_ISOLATION environment variable, one of read_committed,
+	// repeatable_read and serializable, and defaults to repeatable_read.
+	txIsolation sql.IsolationLevel
+}
+
+// subtaskCompletion decides what happens when a todo with open subtasks is
+// completed. It is configured with the SUBTASK_COMPLETION environment variable.
+type subtaskCompletion string
+
+const (
+	// subtasksIndependent leaves the subtasks untouched. It is the default.
+	subtasksIndependent subtaskCompletion = "independent"
+	// subtasksCascade completes every open subtask together with the todo.
+	subtasksCascade subtaskCompletion = "cascade"
+	// subtasksRequired refuses to complete a todo while it has open subtasks.
+	subtasksRequired subtaskCompletion = "require"
+)
+
+func parseSubtaskCompletion(value string) subtaskCompletion {
+	switch rule := subtaskCompletion(value); rule {
+	case subtasksIndependent, subtasksCascade, subtasksRequired:
+		return rule
+	case "":
+	default:
+		log.Printf("unknown SUBTASK_COMPLETION %q, falling back to %q", value, subtasksIndependent)
+	}
+	return subtasksIndependent
+}
+
+func parseLegacyRoutes(value string) bool {
+	if value == "" {
+		return true
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("invalid LEGACY_ROUTES %q, keeping legacy routes enabled", value)
+		return true
+	}
+	return enabled
+}
+
+// defaultIdempotencyTTL is how long responses to requests made with an
+// Idempotency-Key are kept unless IDEMPOTENCY_TTL says otherwise.
+const defaultIdempotencyTTL = 24 * time.Hour
+
+func parseIdempotencyTTL(value string) time.Duration {
+	if value == "" {
+		return defaultIdempotencyTTL
+	}
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl <= 0 {
+		log.Printf("invalid IDEMPOTENCY_TTL %q, falling back to %v", value, defaultIdempotencyTTL)
+		return defaultIdempotencyTTL
+	}
+	return ttl
+}
+
+// defaultTrashRetention is how long deleted todos are kept unless
+// TRASH_RETENTION says otherwise.
+const defaultTrashRetention = 30 * 24 * time.Hour
+
+func parseTrashRetention(value string) time.Duration {
+	if value == "" {
+		return defaultTrashRetention
+	}
+	retention, err := time.ParseDuration(value)
+	if err != nil || retention < 0 {
+		log.Printf("invalid TRASH_RETENTION %q, falling back to %v", value, defaultTrashRetention)
+		return defaultTrashRetention
+	}
+	return retention
+}
+
+// defaultTxIsolation makes a transaction that read a record fail, and be
+// retried, if the record is written concurrently before the transaction
+// writes it back.
+const defaultTxIsolation = sql.LevelRepeatableRead
+
+func parseTxIsolation(value string) sql.IsolationLevel {
+	switch value {
+	case "":
+	case "read_committed":
+		return sql.LevelReadCommitted
+	case "repeatable_read":
+		return sql.LevelRepeatableRead
+	case "serializable":
+		return sql.LevelSerializable
+	default:
+		log.Printf("unknown TX_ISOLATION %q, falling back to %v", value, defaultTxIsolation)
+	}
+	return defaultTxIsolation
 }
 
 func NewServer() *http.Server {
@@ -27,6 +141,12 @@ func NewServer() *http.Server {
 	NewServer := &Server{
 		port: port,
 		db:   database.New(),
+
+		subtaskCompletion: parseSubtaskCompletion(os.Getenv("SUBTASK_COMPLETION")),
+		legacyRoutes:      parseLegacyRoutes(os.Getenv("LEGACY_ROUTES")),
+		idempotencyTTL:    parseIdempotencyTTL(os.Getenv("IDEMPOTENCY_TTL")),
+		trashRetention:    parseTrashRetention(os.Getenv("TRASH_RETENTION")),
+		txIsolation:       parseTxIsolation(os.Getenv("TX_ISOLATION")),
 	}
 	// Declare Server config
 	server := &http.Server{
@@ -37,5 +157,11 @@ func NewServer() *http.Server {
 		WriteTimeout: 30 * time.Second,
 	}
 
+	if NewServer.trashRetention > 0 {
+		ctx, stop := context.WithCancel(context.Background())
+		go NewServer.purgeTrash(ctx, time.Hour)
+		server.RegisterOnShutdown(stop)
+	}
+
 	return server
 }
@@ -0,0 +1,225 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"go-todo/internal/database"
+	"go-todo/internal/models"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// @Summary Get all tags
+// @Description Get all tags ordered by name
+// @Tags tags
+// @Produce json
+// @Success 200 {array} models.Tag
+// @Router /tags [get]
+func (s *Server) getTagsHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("GET %s from %s", r.URL.Path, r.RemoteAddr)
+	tags, err := s.db.GetTags(r.Context())
+	if err != nil {
+		log.Printf("getTagsHandler: failed to fetch tags: %v", err)
+		writeError(w, r, err)
+		return
+	}
+	if tags == nil {
+		tags = []models.Tag{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(tags); err != nil {
+		log.Printf("getTagsHandler: failed to write response: %v", err)
+	}
+}
+
+// @Summary Get a tag by ID
+// @Description Get a tag by ID
+// @Tags tags
+// @Produce json
+// @Param id path int true "Tag ID"
+// @Success 200 {object} models.Tag
+// @Router /tags/{id} [get]
+func (s *Server) getTagHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("GET %s from %s", r.URL.Path, r.RemoteAddr)
+	id, err := parsePathID(r, "id")
+	if err != nil {
+		log.Printf("getTagHandler: invalid ID: %v", err)
+		writeError(w, r, badRequest(err))
+		return
+	}
+
+	tag, err := s.db.GetTag(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, r, notFound("Tag"))
+		return
+	}
+	if err != nil {
+		log.Printf("getTagHandler: failed to fetch tag with id %d: %v", id, err)
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(tag); err != nil {
+		log.Printf("getTagHandler: failed to write response: %v", err)
+	}
+}
+
+type tagPayload struct {
+	Name string `json:"name"`
+}
+
+// @Summary Create tag
+// @Description Create a new tag
+// @Tags tags
+// @Accept json
+// @Produce json
+// @Param tag body tagPayload true "Tag"
+// @Success 201 {object} models.Tag
+// @Failure 409 {object} problem "Tag already exists"
+// @Router /tags [post]
+func (s *Server) createTagHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("POST %s from %s", r.URL.Path, r.RemoteAddr)
+	var payload tagPayload
+	if err := decodeJSON(w, r, &payload); err != nil {
+		log.Printf("createTagHandler: invalid request payload: %v", err)
+		writeError(w, r, err)
+		return
+	}
+
+	tag := models.Tag{Name: normalizeTag(payload.Name)}
+	if err := validateTag(tag); err != nil {
+		log.Printf("createTagHandler: invalid tag: %v", err)
+		writeError(w, r, err)
+		return
+	}
+
+	err := s.db.CreateTag(r.Context(), &tag)
+	if errors.Is(err, database.ErrConflict) {
+		writeError(w, r, errTagExists)
+		return
+	}
+	if err != nil {
+		log.Printf("createTagHandler: failed to create tag: %v", err)
+		writeError(w, r, err)
+		return
+	}
+
+	log.Printf("createTagHandler: created tag with id %d", tag.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(tag); err != nil {
+		log.Printf("createTagHandler: failed to write response: %v", err)
+	}
+}
+
+// @Summary Rename tag
+// @Description Rename an existing tag; todos carrying it pick up the new name
+// @Tags tags
+// @Accept json
+// @Produce json
+// @Param id path int true "Tag ID"
+// @Param tag body tagPayload true "Tag"
+// @Success 200 {object} models.Tag
+// @Failure 409 {object} problem "Tag already exists"
+// @Router /tags/{id} [put]
+func (s *Server) updateTagHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("PUT %s from %s", r.URL.Path, r.RemoteAddr)
+	id, err := parsePathID(r, "id")
+	if err != nil {
+		log.Printf("updateTagHandler: invalid ID: %v", err)
+		writeError(w, r, badRequest(err))
+		return
+	}
+
+	var payload tagPayload
+	if err := decodeJSON(w, r, &payload); err != nil {
+		log.Printf("updateTagHandler: invalid request payload: %v", err)
+		writeError(w, r, err)
+		return
+	}
+
+	tag := models.Tag{ID: id, Name: normalizeTag(payload.Name)}
+	if err := validateTag(tag); err != nil {
+		log.Printf("updateTagHandler: invalid tag: %v", err)
+		writeError(w, r, err)
+		return
+	}
+
+	err = s.db.UpdateTag(r.Context(), &tag)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		writeError(w, r, notFound("Tag"))
+		return
+	case errors.Is(err, database.ErrConflict):
+		writeError(w, r, errTagExists)
+		return
+	case err != nil:
+		log.Printf("updateTagHandler: failed to update tag with id %d: %v", id, err)
+		writeError(w, r, err)
+		return
+	}
+
+	log.Printf("updateTagHandler: updated tag with id %d", id)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(tag); err != nil {
+		log.Printf("updateTagHandler: failed to write response: %v", err)
+	}
+}
+
+// @Summary Delete tag
+// @Description Delete a tag and remove it from every todo
+// @Tags tags
+// @Param id path int true "Tag ID"
+// @Success 204
+// @Router /tags/{id} [delete]
+func (s *Server) deleteTagHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("DELETE %s from %s", r.URL.Path, r.RemoteAddr)
+	id, err := parsePathID(r, "id")
+	if err != nil {
+		log.Printf("deleteTagHandler: invalid ID: %v", err)
+		writeError(w, r, badRequest(err))
+		return
+	}
+
+	ctx := r.Context()
+	err = s.db.WithTx(ctx, s.txIsolation, func(tx database.Store) error {
+		if _, err := tx.GetTag(ctx, id); err != nil {
+			return lookupError("Tag", err)
+		}
+		return tx.DeleteTag(ctx, id)
+	})
+	if err != nil {
+		log.Printf("deleteTagHandler: failed to delete tag with id %d: %v", id, err)
+		writeError(w, r, err)
+		return
+	}
+
+	log.Printf("deleteTagHandler: deleted tag with id %d", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// normalizeTag trims and lower-cases a tag name so that "Backend" and
+// " backend " refer to the same tag.
+func normalizeTag(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// normalizeTags normalizes names and drops empty and duplicate entries.
+// The result is never nil.
+func normalizeTags(names []string) []string {
+	tags := make([]string, 0, len(names))
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		name = normalizeTag(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		tags = append(tags, name)
+	}
+	return tags
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"encoding/json"
+	"go-todo/internal/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTagHandlers(t *testing.T) {
+	s := newTestServer(t)
+	handler := s.RegisterRoutes()
+
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	// Create
+	w := do(http.MethodPost, "/tags", `{"name":" Backend "}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d", w.Code)
+	}
+	var created models.Tag
+	if err := json.NewDecoder(w.Body).Decode(&created); err != nil {
+		t.Fatalf("could not decode response: %v", err)
+	}
+	if created.Name != "backend" {
+		t.Errorf("expected normalized name %q, got %q", "backend", created.Name)
+	}
+
+	// Duplicate
+	if w := do(http.MethodPost, "/tags", `{"name":"backend"}`); w.Code != http.StatusConflict {
+		t.Errorf("expected status 409 for duplicate tag, got %d", w.Code)
+	}
+
+	// Missing name
+	if w := do(http.MethodPost, "/tags", `{"name":"  "}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for empty name, got %d", w.Code)
+	}
+
+	// Rename
+	w = do(http.MethodPut, "/tags/1", `{"name":"api"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	// Get
+	w = do(http.MethodGet, "/tags/1", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	var got models.Tag
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatalf("could not decode response: %v", err)
+	}
+	if got.Name != "api" {
+		t.Errorf("expected renamed tag %q, got %q", "api", got.Name)
+	}
+
+	// List
+	w = do(http.MethodGet, "/tags", "")
+	var tags []models.Tag
+	if err := json.NewDecoder(w.Body).Decode(&tags); err != nil {
+		t.Fatalf("could not decode response: %v", err)
+	}
+	if len(tags) != 1 {
+		t.Errorf("expected 1 tag, got %d", len(tags))
+	}
+
+	// Delete
+	if w := do(http.MethodDelete, "/tags/1", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("expected status 204, got %d", w.Code)
+	}
+	if w := do(http.MethodGet, "/tags/1", ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 after delete, got %d", w.Code)
+	}
+}
@@ -1,30 +1,88 @@
 package server
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"go-todo/internal/database"
 	"go-todo/internal/models"
+	"io"
 	"log"
 	"net/http"
+	"slices"
 	"strconv"
-	"strings"
+	"time"
 )
 
 // @Summary Get all todos
-// @Description Get all todos
+// @Description Get all todos that are not archived, optionally filtered. The filter parameter takes
+// @Description an expression such as `completed:false AND (priority>=2 OR tag:urgent)` comparing the
+// @Description fields completed, priority, project_id, parent_id, start_at, due_at, created_at,
+// @Description updated_at, completed_at, title, description and tag with =, :, !=, <, <=, >, >= or ~
+// @Description (contains), combined with AND, OR, NOT and parentheses.
 // @Tags todos
 // @Produce json
+// @Param due query string false "Due date filter" Enums(overdue, today)
+// @Param due_within query int false "Only todos due within the next N days"
+// @Param tag query []string false "Only todos carrying these tags" collectionFormat(multi)
+// @Param tag_match query string false "Whether todos need any or all of the tags (default any)" Enums(any, all)
+// @Param project_id query int false "Only todos of this project"
+// @Param completed query bool false "Only completed or open todos"
+// @Param due_after query string false "Only todos due at or after this date or RFC 3339 time"
+// @Param due_before query string false "Only todos due before this date or RFC 3339 time"
+// @Param created_after query string false "Only todos created at or after this date or RFC 3339 time"
+// @Param created_before query string false "Only todos created before this date or RFC 3339 time"
+// @Param contains query string false "Only todos whose title or description contains this text"
+// @Param filter query string false "Filter expression, e.g. completed:false AND priority>=2"
+// @Param include query string false "Also list archived todos" Enums(archived)
+// @Param sort query string false "Comma-separated sort fields (priority, due_at, created_at, title), prefix with - for descending"
+// @Param limit query int false "Page size (max 500); without limit or cursor all todos are returned"
+// @Param cursor query string false "Cursor of the page to fetch, taken from X-Next-Cursor"
 // @Success 200 {array} models.Todo
+// @Header 200 {string} X-Next-Cursor "Cursor of the next page, absent on the last page"
+// @Header 200 {string} Link "URL of the next page with rel=next"
 // @Router /todos [get]
 func (s *Server) getTodosHandler(w http.ResponseWriter, r *http.Request) {
 	log.Printf("GET %s from %s", r.URL.Path, r.RemoteAddr)
-	todos, err := s.db.GetTodos()
+	filter, err := parseTodoFilter(r)
 	if err != nil {
-		log.Printf("getTodosHandler: failed to fetch todos: %v", err)
-		http.Error(w, "Failed to fetch todos", http.StatusInternalServerError)
+		log.Printf("getTodosHandler: invalid filter: %v", err)
+		writeError(w, r, badRequest(err))
 		return
 	}
 
+	limit, cursor, paged, err := parsePage(r)
+	if err != nil {
+		log.Printf("getTodosHandler: invalid page: %v", err)
+		writeError(w, r, badRequest(err))
+		return
+	}
+
+	var todos []models.Todo
+	if paged {
+		page, err := s.db.GetTodoPage(r.Context(), filter, limit, cursor)
+		if err != nil {
+			log.Printf("getTodosHandler: failed to fetch todos: %v", err)
+			writeError(w, r, err)
+			return
+		}
+		todos = page.Todos
+		if page.Next != "" {
+			setNextPage(w, r, page.Next)
+		}
+	} else {
+		todos, err = s.db.GetTodos(r.Context(), filter)
+		if err != nil {
+			log.Printf("getTodosHandler: failed to fetch todos: %v", err)
+			writeError(w, r, err)
+			return
+		}
+	}
+	if todos == nil {
+		todos = []models.Todo{}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(todos); err != nil {
 		log.Printf("getTodosHandler: failed to write response: %v", err)
@@ -32,25 +90,37 @@ func (s *Server) getTodosHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // @Summary Get a todo by ID
-// @Description Get a todo by ID
+// @Description Get a todo by ID. The ETag response header changes with the todo, its progress and its tags; send it
+// @Description in If-None-Match to skip unchanged todos or in If-Match to guard writes.
 // @Tags todos
 // @Produce json
 // @Param id path int true "Todo ID"
+// @Param If-None-Match header string false "ETag of a cached copy"
 // @Success 200 {object} models.Todo
-// @Router /todo/{id} [get]
+// @Success 304 "Todo has not changed"
+// @Failure 400 {object} problem "Invalid request"
+// @Failure 404 {object} problem "Todo not found"
+// @Router /todos/{id} [get]
 func (s *Server) getTodoHandler(w http.ResponseWriter, r *http.Request) {
 	log.Printf("GET %s from %s", r.URL.Path, r.RemoteAddr)
-	id, err := parseIDFromPath(r)
+	id, err := parsePathID(r, "id")
 	if err != nil {
 		log.Printf("getTodoHandler: invalid ID: %v", err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, badRequest(err))
 		return
 	}
 
-	todo, err := s.db.GetTodo(id)
+	todo, err := s.db.GetTodo(r.Context(), id)
 	if err != nil {
 		log.Printf("getTodoHandler: failed to fetch todo with id %d: %v", id, err)
-		http.Error(w, "Failed to fetch todo", http.StatusInternalServerError)
+		writeError(w, r, lookupError("Todo", err))
+		return
+	}
+
+	etag := todoETag(todo)
+	w.Header().Set("ETag", etag)
+	if header := r.Header.Get("If-None-Match"); header != "" && etagMatches(header, etag, true) {
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 
@@ -61,9 +131,37 @@ func (s *Server) getTodoHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 type newTodo struct {
-	Title       string `json:"title"`
-	Description string `json:"description"`
-	Completed   *bool  `json:"completed"`
+	todoReadOnly
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Completed   *bool      `json:"completed"`
+	Priority    int        `json:"priority"`
+	StartAt     *time.Time `json:"start_at"`
+	DueAt       *time.Time `json:"due_at"`
+	Tags        []string   `json:"tags"`
+	ProjectID   *int       `json:"project_id"`
+	ParentID    *int       `json:"parent_id"`
+	Recurrence  string     `json:"recurrence"`
+}
+
+// todo validates the payload and returns the todo it describes.
+func (p newTodo) todo() (models.Todo, error) {
+	var v validator
+	v.check(p.Completed != nil, "completed", "is required")
+	todo := models.Todo{
+		Title:       p.Title,
+		Description: p.Description,
+		Completed:   p.Completed != nil && *p.Completed,
+		Priority:    p.Priority,
+		StartAt:     p.StartAt,
+		DueAt:       p.DueAt,
+		Tags:        validateTags(&v, p.Tags),
+		ProjectID:   p.ProjectID,
+		ParentID:    p.ParentID,
+		Recurrence:  p.Recurrence,
+	}
+	validateTodo(&v, &todo)
+	return todo, v.err()
 }
 
 // @Summary Create todo
@@ -72,145 +170,399 @@ type newTodo struct {
 // @Accept json
 // @Produce json
 // @Param todo body newTodo true "Todo"
+// @Param Idempotency-Key header string false "Unique key that makes retries of this request safe"
 // @Success 201 {object} models.Todo
-// @Router /todo/create [post]
+// @Failure 400 {object} problem "Invalid request"
+// @Failure 409 {object} problem "A request with the same Idempotency-Key is in progress"
+// @Failure 422 {object} problem "Idempotency-Key was used for a different request"
+// @Router /todos [post]
 func (s *Server) createTodoHandler(w http.ResponseWriter, r *http.Request) {
 	log.Printf("POST %s from %s", r.URL.Path, r.RemoteAddr)
 	var newTodo newTodo
-	if err := json.NewDecoder(r.Body).Decode(&newTodo); err != nil {
+	if err := decodeJSON(w, r, &newTodo); err != nil {
 		log.Printf("createTodoHandler: invalid request payload: %v", err)
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		writeError(w, r, err)
 		return
 	}
 
-	if newTodo.Title == "" || newTodo.Description == "" || newTodo.Completed == nil {
-		log.Printf("createTodoHandler: missing required fields")
-		http.Error(w, "Missing required fields", http.StatusBadRequest)
+	todo, err := newTodo.todo()
+	if err != nil {
+		log.Printf("createTodoHandler: invalid todo: %v", err)
+		writeError(w, r, err)
 		return
 	}
 
-	todo := models.Todo{
-		Title:       newTodo.Title,
-		Description: newTodo.Description,
-		Completed:   *newTodo.Completed,
+	err = s.db.CreateTodo(r.Context(), &todo)
+	if errors.Is(err, database.ErrInvalidReference) {
+		writeError(w, r, errUnknownProjectOrParent)
+		return
 	}
-
-	if err := s.db.CreateTodo(&todo); err != nil {
+	if err != nil {
 		log.Printf("createTodoHandler: failed to create todo: %v", err)
-		http.Error(w, "Failed to create todo", http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
 	log.Printf("createTodoHandler: created todo with id %d", todo.ID)
-	w.WriteHeader(http.StatusCreated)
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", todoETag(todo))
+	w.WriteHeader(http.StatusCreated)
 	if err := json.NewEncoder(w).Encode(todo); err != nil {
 		log.Printf("createTodoHandler: failed to write response: %v", err)
 	}
 }
 
 type updateTodo struct {
-	Title       string `json:"title"`
-	Description string `json:"description"`
-	Completed   *bool  `json:"completed"`
+	todoReadOnly
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Completed   *bool      `json:"completed"`
+	Priority    int        `json:"priority"`
+	StartAt     *time.Time `json:"start_at"`
+	DueAt       *time.Time `json:"due_at"`
+	// Tags replaces the todo's tags; omit it to keep the current ones.
+	Tags       []string `json:"tags"`
+	ProjectID  *int     `json:"project_id"`
+	ParentID   *int     `json:"parent_id"`
+	Recurrence string   `json:"recurrence"`
 }
 
 // @Summary Update todo
-// @Description Update an existing todo
+// @Description Update an existing todo. Completing a recurring todo creates its next occurrence.
 // @Tags todos
 // @Accept json
 // @Produce json
 // @Param id path int true "Todo ID"
 // @Param todo body updateTodo true "Todo"
+// @Param If-Match header string false "ETag the update is based on"
 // @Success 200 {object} models.Todo
-// @Router /todo/update/{id} [put]
+// @Failure 400 {object} problem "Invalid request"
+// @Failure 404 {object} problem "Todo not found"
+// @Failure 409 {object} problem "Todo has open subtasks (with SUBTASK_COMPLETION=require)"
+// @Failure 412 {object} problem "Todo was modified since the If-Match ETag"
+// @Router /todos/{id} [put]
 func (s *Server) updateTodoHandler(w http.ResponseWriter, r *http.Request) {
 	log.Printf("PUT %s from %s", r.URL.Path, r.RemoteAddr)
-	id, err := parseIDFromPath(r)
+	id, err := parsePathID(r, "id")
 	if err != nil {
 		log.Printf("updateTodoHandler: invalid ID: %v", err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, badRequest(err))
 		return
 	}
 
-	todo, err := s.db.GetTodo(id)
+	var updateTodo updateTodo
+	if err := decodeJSON(w, r, &updateTodo); err != nil {
+		log.Printf("updateTodoHandler: invalid request payload: %v", err)
+		writeError(w, r, err)
+		return
+	}
+
+	s.saveTodo(w, r, "updateTodoHandler", id, func(_ database.Store, todo *models.Todo) ([]string, error) {
+		var v validator
+		v.check(updateTodo.Completed != nil, "completed", "is required")
+		todo.Title = updateTodo.Title
+		todo.Description = updateTodo.Description
+		todo.Completed = updateTodo.Completed != nil && *updateTodo.Completed
+		todo.Priority = updateTodo.Priority
+		todo.StartAt = updateTodo.StartAt
+		todo.DueAt = updateTodo.DueAt
+		if updateTodo.Tags != nil {
+			todo.Tags = validateTags(&v, updateTodo.Tags)
+		}
+		todo.ProjectID = updateTodo.ProjectID
+		todo.ParentID = updateTodo.ParentID
+		todo.Recurrence = updateTodo.Recurrence
+		validateTodo(&v, todo)
+		return nil, v.err()
+	})
+}
+
+// @Summary Patch todo
+// @Description Update only the fields present in an RFC 7396 JSON merge patch; null resets a field.
+// @Description Completing a recurring todo creates its next occurrence.
+// @Tags todos
+// @Accept application/merge-patch+json
+// @Produce json
+// @Param id path int true "Todo ID"
+// @Param patch body updateTodo true "Fields to change"
+// @Param If-Match header string false "ETag the patch is based on"
+// @Success 200 {object} models.Todo
+// @Failure 400 {object} problem "Invalid request"
+// @Failure 404 {object} problem "Todo not found"
+// @Failure 409 {object} problem "Todo has open subtasks (with SUBTASK_COMPLETION=require)"
+// @Failure 412 {object} problem "Todo was modified since the If-Match ETag"
+// @Failure 415 {object} problem "Unsupported patch format"
+// @Router /todos/{id} [patch]
+func (s *Server) patchTodoHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("PATCH %s from %s", r.URL.Path, r.RemoteAddr)
+	id, err := parsePathID(r, "id")
 	if err != nil {
-		log.Printf("updateTodoHandler: todo not found with id %d: %v", id, err)
-		http.Error(w, "Todo not found", http.StatusNotFound)
+		log.Printf("patchTodoHandler: invalid ID: %v", err)
+		writeError(w, r, badRequest(err))
 		return
 	}
 
-	var updateTodo updateTodo
-	if err := json.NewDecoder(r.Body).Decode(&updateTodo); err != nil {
-		log.Printf("updateTodoHandler: invalid request payload: %v", err)
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+	if !isMergePatch(r) {
+		writeError(w, r, &apiError{http.StatusUnsupportedMediaType, "unsupported_media_type", "Content-Type must be " + mergePatchType, nil})
 		return
 	}
 
-	if updateTodo.Title == "" || updateTodo.Description == "" || updateTodo.Completed == nil {
-		log.Printf("updateTodoHandler: missing required fields")
-		http.Error(w, "Missing required fields", http.StatusBadRequest)
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	if err != nil {
+		log.Printf("patchTodoHandler: failed to read request body: %v", err)
+		writeError(w, r, payloadError(err))
 		return
 	}
 
-	todo.Title = updateTodo.Title
-	todo.Description = updateTodo.Description
-	todo.Completed = *updateTodo.Completed
+	s.saveTodo(w, r, "patchTodoHandler", id, func(_ database.Store, todo *models.Todo) ([]string, error) {
+		fields, err := applyMergePatch(todo, body)
+		if err != nil {
+			return nil, badRequest(err)
+		}
+		return fields, validatePatchedTodo(todo, fields)
+	})
+}
+
+// saveTodo reads the todo with the given id, lets change modify it and writes
+// it back in a single transaction, then responds with the todo as stored.
+// change returns the fields it modified, which are patched, or nil to write
+// the whole todo. If the todo becomes completed, the subtask completion rule
+// is enforced and the next occurrence of a recurring todo is created.
+func (s *Server) saveTodo(w http.ResponseWriter, r *http.Request, handler string, id int, change func(tx database.Store, todo *models.Todo) ([]string, error)) {
+	ctx := r.Context()
+	var todo models.Todo
+	var next *models.Todo
+	err := s.db.WithTx(ctx, s.txIsolation, func(tx database.Store) error {
+		var err error
+		if todo, err = tx.GetTodo(ctx, id); err != nil {
+			return lookupError("Todo", err)
+		}
+		if err := checkIfMatch(r, todo); err != nil {
+			return err
+		}
+		wasCompleted := todo.Completed
+		fields, err := change(tx, &todo)
+		if err != nil {
+			return err
+		}
 
-	if err := s.db.UpdateTodo(&todo); err != nil {
-		log.Printf("updateTodoHandler: failed to update todo with id %d: %v", id, err)
-		http.Error(w, "Failed to update todo", http.StatusInternalServerError)
+		next = nil
+		cascade := false
+		if !wasCompleted && todo.Completed {
+			if next, cascade, err = s.completeTodo(&todo); err != nil {
+				return err
+			}
+			if next != nil && fields != nil && !slices.Contains(fields, "recurrence") {
+				fields = append(fields, "recurrence")
+			}
+		}
+
+		if fields == nil {
+			err = tx.UpdateTodo(ctx, &todo)
+		} else {
+			err = tx.PatchTodo(ctx, &todo, fields)
+		}
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return notFound("Todo")
+		case errors.Is(err, database.ErrInvalidReference):
+			return errUnknownProjectOrParent
+		case err != nil:
+			return err
+		}
+
+		if cascade {
+			if err := tx.CompleteDescendants(ctx, id); err != nil {
+				return fmt.Errorf("completing subtasks: %w", err)
+			}
+			done := 100
+			todo.Progress = &done
+		}
+		if next != nil {
+			if err := tx.CreateTodo(ctx, next); err != nil {
+				return fmt.Errorf("creating next occurrence: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("%s: failed to update todo with id %d: %v", handler, id, err)
+		writeError(w, r, err)
 		return
 	}
 
-	log.Printf("updateTodoHandler: updated todo with id %d", id)
+	if next != nil {
+		log.Printf("%s: created next occurrence of todo with id %d with id %d", handler, id, next.ID)
+	}
+	log.Printf("%s: updated todo with id %d", handler, id)
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", todoETag(todo))
 	if err := json.NewEncoder(w).Encode(todo); err != nil {
-		log.Printf("updateTodoHandler: failed to write response: %v", err)
+		log.Printf("%s: failed to write response: %v", handler, err)
+	}
+}
+
+// @Summary Get the subtasks of a todo
+// @Description Get the direct subtasks of a todo; accepts the same filters as GET /todos
+// @Tags todos
+// @Produce json
+// @Param id path int true "Todo ID"
+// @Success 200 {array} models.Todo
+// @Router /todos/{id}/children [get]
+func (s *Server) getTodoChildrenHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("GET %s from %s", r.URL.Path, r.RemoteAddr)
+	id, err := parsePathID(r, "id")
+	if err != nil {
+		log.Printf("getTodoChildrenHandler: invalid ID: %v", err)
+		writeError(w, r, badRequest(err))
+		return
+	}
+
+	filter, err := parseTodoFilter(r)
+	if err != nil {
+		log.Printf("getTodoChildrenHandler: invalid filter: %v", err)
+		writeError(w, r, badRequest(err))
+		return
+	}
+	filter.ParentID = &id
+
+	if _, err := s.db.GetTodo(r.Context(), id); err != nil {
+		log.Printf("getTodoChildrenHandler: failed to fetch todo with id %d: %v", id, err)
+		writeError(w, r, lookupError("Todo", err))
+		return
+	}
+
+	todos, err := s.db.GetTodos(r.Context(), filter)
+	if err != nil {
+		log.Printf("getTodoChildrenHandler: failed to fetch subtasks of todo with id %d: %v", id, err)
+		writeError(w, r, err)
+		return
+	}
+	if todos == nil {
+		todos = []models.Todo{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(todos); err != nil {
+		log.Printf("getTodoChildrenHandler: failed to write response: %v", err)
+	}
+}
+
+// @Summary Get a todo with all of its subtasks
+// @Description Get a todo together with its subtasks, nested to any depth
+// @Tags todos
+// @Produce json
+// @Param id path int true "Todo ID"
+// @Success 200 {object} models.TodoNode
+// @Router /todos/{id}/tree [get]
+func (s *Server) getTodoTreeHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("GET %s from %s", r.URL.Path, r.RemoteAddr)
+	id, err := parsePathID(r, "id")
+	if err != nil {
+		log.Printf("getTodoTreeHandler: invalid ID: %v", err)
+		writeError(w, r, badRequest(err))
+		return
+	}
+
+	tree, err := s.db.GetTodoTree(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, r, notFound("Todo"))
+		return
+	}
+	if err != nil {
+		log.Printf("getTodoTreeHandler: failed to fetch tree of todo with id %d: %v", id, err)
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(tree); err != nil {
+		log.Printf("getTodoTreeHandler: failed to write response: %v", err)
 	}
 }
 
 // @Summary Delete todo
-// @Description Delete a todo by ID
+// @Description Move a todo together with its subtasks to the trash, from where it can be restored
+// @Description until it is purged
 // @Tags todos
 // @Param id path int true "Todo ID"
+// @Param If-Match header string false "ETag the deletion is based on"
 // @Success 204
-// @Router /todo/delete/{id} [delete]
+// @Failure 400 {object} problem "Invalid request"
+// @Failure 404 {object} problem "Todo not found"
+// @Failure 412 {object} problem "Todo was modified since the If-Match ETag"
+// @Router /todos/{id} [delete]
 func (s *Server) deleteTodoHandler(w http.ResponseWriter, r *http.Request) {
 	log.Printf("DELETE %s from %s", r.URL.Path, r.RemoteAddr)
-	id, err := parseIDFromPath(r)
+	id, err := parsePathID(r, "id")
 	if err != nil {
 		log.Printf("deleteTodoHandler: invalid ID: %v", err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, badRequest(err))
 		return
 	}
 
-	todo, err := s.db.GetTodo(id)
+	ctx := r.Context()
+	err = s.db.WithTx(ctx, s.txIsolation, func(tx database.Store) error {
+		todo, err := tx.GetTodo(ctx, id)
+		if err != nil {
+			return lookupError("Todo", err)
+		}
+		if err := checkIfMatch(r, todo); err != nil {
+			return err
+		}
+		return lookupError("Todo", tx.DeleteTodo(ctx, id))
+	})
 	if err != nil {
-		log.Printf("deleteTodoHandler: todo not found with id %d: %v", id, err)
-		http.Error(w, "Todo not found", http.StatusNotFound)
-		return
-	}
-
-	if err := s.db.DeleteTodo(todo.ID); err != nil {
 		log.Printf("deleteTodoHandler: failed to delete todo with id %d: %v", id, err)
-		http.Error(w, "Failed to delete todo", http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
-	log.Printf("deleteTodoHandler: deleted todo with id %d", id)
+	log.Printf("deleteTodoHandler: moved todo with id %d to the trash", id)
 	w.WriteHeader(http.StatusNoContent)
 }
 
-func parseIDFromPath(r *http.Request) (int, error) {
-	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
-	if len(parts) == 0 {
-		return 0, fmt.Errorf("missing todo ID")
+// completeTodo applies the subtask completion rule to a todo that is being
+// completed and returns whether its open subtasks must be completed with it.
+// If the todo recurs, its next occurrence is returned as well and takes over
+// the recurrence, so that reopening and completing this todo again does not
+// create a duplicate.
+func (s *Server) completeTodo(todo *models.Todo) (next *models.Todo, cascade bool, err error) {
+	openSubtasks := todo.Progress != nil && *todo.Progress < 100
+	if openSubtasks && s.subtaskCompletion == subtasksRequired {
+		return nil, false, errOpenSubtasks
+	}
+	if occurrence, ok := nextOccurrence(*todo); ok {
+		todo.Recurrence = ""
+		next = &occurrence
+	}
+	return next, openSubtasks && s.subtaskCompletion == subtasksCascade, nil
+}
+
+// maxPriority is the highest todo priority; 0 means no priority.
+const maxPriority = 4
+
+func validatePriority(priority int) error {
+	if priority < 0 || priority > maxPriority {
+		return invalidField("priority", "must be between 0 and %d", maxPriority)
+	}
+	return nil
+}
+
+// validateSchedule ensures a todo does not start after it is due.
+func validateSchedule(startAt, dueAt *time.Time) error {
+	if startAt != nil && dueAt != nil && startAt.After(*dueAt) {
+		return invalidField("start_at", "must not be after due_at")
 	}
-	idStr := parts[len(parts)-1]
-	id, err := strconv.Atoi(idStr)
+	return nil
+}
+
+// parsePathID reads the integer wildcard name from a route pattern such as
+// "/tags/{id}".
+func parsePathID(r *http.Request, name string) (int, error) {
+	id, err := strconv.Atoi(r.PathValue(name))
 	if err != nil {
-		return 0, fmt.Errorf("invalid todo ID")
+		return 0, invalidField(name, "must be an integer")
 	}
 	return id, nil
 }
@@ -1,52 +1,24 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"go-todo/internal/database"
 	"go-todo/internal/models"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 )
 
-func (m *mockDBService) GetTodos() ([]models.Todo, error) {
-	result := make([]models.Todo, 0, len(m.todos))
-	for _, todo := range m.todos {
-		result = append(result, todo)
-	}
-	return result, nil
-}
-
-func (m *mockDBService) GetTodo(id int) (models.Todo, error) {
-	todo, ok := m.todos[id]
-	if !ok {
-		return models.Todo{}, http.ErrMissingFile
-	}
-	return todo, nil
-}
-
-func (m *mockDBService) CreateTodo(todo *models.Todo) error {
-	todo.ID = m.nextID
-	m.todos[todo.ID] = *todo
-	m.nextID++
-	return nil
-}
-
-func (m *mockDBService) UpdateTodo(todo *models.Todo) error {
-	if _, ok := m.todos[todo.ID]; !ok {
-		return http.ErrMissingFile
-	}
-	m.todos[todo.ID] = *todo
-	return nil
-}
-
-func (m *mockDBService) DeleteTodo(id int) error {
-	delete(m.todos, id)
-	return nil
-}
-
 func TestGetTodosHandler(t *testing.T) {
-	s := &Server{db: newMockDBService()}
+	s := newTestServer(t)
 	created := createTestTodo(s, models.Todo{Title: "Test", Description: "Test Desc", Completed: false})
 
 	req := httptest.NewRequest(http.MethodGet, "/todos", nil)
@@ -74,11 +46,139 @@ func TestGetTodosHandler(t *testing.T) {
 	}
 }
 
+func TestParseTodoFilter(t *testing.T) {
+	open := false
+	may, june := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	expr, err := database.ParseFilter("priority>=2 OR tag:urgent")
+	if err != nil {
+		t.Fatalf("ParseFilter failed: %v", err)
+	}
+
+	tests := []struct {
+		query string
+		want  database.TodoFilter
+	}{
+		{"", database.TodoFilter{}},
+		{"?due=overdue", database.TodoFilter{Due: database.DueOverdue}},
+		{"?due=today", database.TodoFilter{Due: database.DueToday}},
+		{"?due_within=7", database.TodoFilter{Due: database.DueWithin, DueWithinDays: 7}},
+		{"?tag=Backend&tag=urgent", database.TodoFilter{Tags: []string{"backend", "urgent"}}},
+		{"?tag=q3&tag_match=all", database.TodoFilter{Tags: []string{"q3"}, TagMatch: database.TagMatchAll}},
+		{"?sort=-priority,due_at", database.TodoFilter{Sort: []database.SortKey{
+			{Field: database.SortPriority, Desc: true},
+			{Field: database.SortDueAt},
+		}}},
+		{"?completed=false", database.TodoFilter{Completed: &open}},
+		{"?due_after=2024-05-01T00:00:00Z&created_before=2024-06-01T12:00:00Z", database.TodoFilter{
+			DueRange:     database.TimeRange{After: &may},
+			CreatedRange: database.TimeRange{Before: &june},
+		}},
+		{"?contains=+report+", database.TodoFilter{Contains: "report"}},
+		{"?filter=priority%3E%3D2+OR+tag%3Aurgent", database.TodoFilter{Expr: expr}},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/todos"+tt.query, nil)
+		filter, err := parseTodoFilter(req)
+		if err != nil {
+			t.Fatalf("%q: failed to parse filter: %v", tt.query, err)
+		}
+		if !reflect.DeepEqual(filter, tt.want) {
+			t.Errorf("%q: expected filter %+v, got %+v", tt.query, tt.want, filter)
+		}
+	}
+}
+
+func TestGetTodosHandlerInvalidDueFilter(t *testing.T) {
+	for _, query := range []string{"?due=tomorrow", "?due_within=-1", "?due_within=abc", "?due=today&due_within=3", "?tag=a&tag_match=some",
+		"?sort=color", "?sort=title,-title", "?sort=title,", "?completed=maybe", "?due_before=tomorrow",
+		"?filter=priority%3E%3E2", "?filter=completed%3Afalse+AND"} {
+		s := newTestServer(t)
+
+		req := httptest.NewRequest(http.MethodGet, "/todos"+query, nil)
+		w := httptest.NewRecorder()
+
+		s.getTodosHandler(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%q: expected status 400, got %d", query, w.Code)
+		}
+	}
+}
+
+func TestGetTodosHandlerFilterError(t *testing.T) {
+	s := newTestServer(t)
+	req := httptest.NewRequest(http.MethodGet, "/todos?filter="+url.QueryEscape("completed:false AND color:red"), nil)
+	w := httptest.NewRecorder()
+	s.getTodosHandler(w, req)
+
+	p := decodeProblem(t, w)
+	want := []fieldError{{"filter", `is invalid: unknown field "color" at position 21`}}
+	if w.Code != http.StatusBadRequest || !reflect.DeepEqual(p.Errors, want) {
+		t.Errorf("expected status 400 with %+v, got %d %+v", want, w.Code, p.Errors)
+	}
+}
+
+func TestGetTodosHandlerPagination(t *testing.T) {
+	s := newTestServer(t)
+	for i := 0; i < 5; i++ {
+		createTestTodo(s, models.Todo{Title: fmt.Sprintf("Todo %d", 5-i), Description: "Paged"})
+	}
+
+	var seen []int
+	path := "/todos?limit=2&sort=title"
+	for pages := 0; path != ""; pages++ {
+		if pages > 3 {
+			t.Fatal("expected pagination to end after 3 pages")
+		}
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		w := httptest.NewRecorder()
+		s.getTodosHandler(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d", path, w.Code)
+		}
+
+		var todos []models.Todo
+		if err := json.NewDecoder(w.Body).Decode(&todos); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		for _, todo := range todos {
+			seen = append(seen, todo.ID)
+		}
+
+		path = ""
+		if cursor := w.Header().Get("X-Next-Cursor"); cursor != "" {
+			path = "/todos?cursor=" + cursor + "&limit=2&sort=title"
+			if link := w.Header().Get("Link"); link != "<"+path+`>; rel="next"` {
+				t.Errorf("unexpected Link header %q", link)
+			}
+		}
+	}
+	if !slices.Equal(seen, []int{5, 4, 3, 2, 1}) {
+		t.Errorf("expected todos 5-1 across pages in title order, got %v", seen)
+	}
+}
+
+func TestGetTodosHandlerInvalidPage(t *testing.T) {
+	for _, query := range []string{"?limit=0", "?limit=501", "?limit=abc", "?cursor=garbage"} {
+		s := newTestServer(t)
+
+		req := httptest.NewRequest(http.MethodGet, "/todos"+query, nil)
+		w := httptest.NewRecorder()
+
+		s.getTodosHandler(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%q: expected status 400, got %d", query, w.Code)
+		}
+	}
+}
+
 func TestGetTodoHandler(t *testing.T) {
-	s := &Server{db: newMockDBService()}
+	s := newTestServer(t)
 	created := createTestTodo(s, models.Todo{Title: "Test", Description: "Test Desc", Completed: false})
 
 	req := httptest.NewRequest(http.MethodGet, "/todos/1", nil)
+	req.SetPathValue("id", "1")
 	w := httptest.NewRecorder()
 
 	s.getTodoHandler(w, req)
@@ -101,7 +201,7 @@ func TestGetTodoHandler(t *testing.T) {
 }
 
 func TestCreateTodoHandler(t *testing.T) {
-	s := &Server{db: newMockDBService()}
+	s := newTestServer(t)
 	newTodo := models.Todo{Title: "New Todo", Description: "New Desc", Completed: false}
 	createdTodo := createTestTodo(s, newTodo)
 
@@ -116,13 +216,60 @@ func TestCreateTodoHandler(t *testing.T) {
 	}
 }
 
+func TestCreateTodoHandlerWithDates(t *testing.T) {
+	s := newTestServer(t)
+	startAt := time.Date(2025, 6, 1, 9, 0, 0, 0, time.UTC)
+	dueAt := startAt.Add(48 * time.Hour)
+	created := createTestTodo(s, models.Todo{Title: "Report", Description: "Quarterly report", StartAt: &startAt, DueAt: &dueAt})
+
+	if created.StartAt == nil || !created.StartAt.Equal(startAt) {
+		t.Errorf("expected start_at %v, got %v", startAt, created.StartAt)
+	}
+	if created.DueAt == nil || !created.DueAt.Equal(dueAt) {
+		t.Errorf("expected due_at %v, got %v", dueAt, created.DueAt)
+	}
+}
+
+func TestCreateTodoHandlerPriority(t *testing.T) {
+	s := newTestServer(t)
+	created := createTestTodo(s, models.Todo{Title: "Urgent", Description: "Fix it", Priority: 4})
+	if created.Priority != 4 {
+		t.Errorf("expected priority 4, got %d", created.Priority)
+	}
+
+	for _, priority := range []int{-1, 5} {
+		body := fmt.Sprintf(`{"title":"Urgent","description":"Fix it","completed":false,"priority":%d}`, priority)
+		req := httptest.NewRequest(http.MethodPost, "/todo/create", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		s.createTodoHandler(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("priority %d: expected status 400, got %d", priority, w.Code)
+		}
+	}
+}
+
+func TestCreateTodoHandlerStartAfterDue(t *testing.T) {
+	s := newTestServer(t)
+	body := `{"title":"Report","description":"Quarterly report","completed":false,` +
+		`"start_at":"2025-06-03T09:00:00Z","due_at":"2025-06-01T09:00:00Z"}`
+	req := httptest.NewRequest(http.MethodPost, "/todo/create", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	s.createTodoHandler(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", w.Code)
+	}
+}
+
 func TestUpdateTodoHandler(t *testing.T) {
-	s := &Server{db: newMockDBService()}
+	s := newTestServer(t)
 	existingTodo := createTestTodo(s, models.Todo{Title: "Test", Description: "Test Desc", Completed: false})
 
 	updated := models.Todo{ID: existingTodo.ID, Title: "Updated Todo", Description: "Updated Desc", Completed: true}
 	body, _ := json.Marshal(updated)
 	req := httptest.NewRequest(http.MethodPut, "/todos/1", strings.NewReader(string(body)))
+	req.SetPathValue("id", "1")
 	w := httptest.NewRecorder()
 
 	s.updateTodoHandler(w, req)
@@ -153,11 +300,247 @@ func TestUpdateTodoHandler(t *testing.T) {
 	}
 }
 
+func TestTodoHandlersTags(t *testing.T) {
+	s := newTestServer(t)
+	created := createTestTodo(s, models.Todo{Title: "Test", Description: "Test Desc", Tags: []string{"Backend", " urgent", "backend"}})
+	if !reflect.DeepEqual(created.Tags, []string{"backend", "urgent"}) {
+		t.Fatalf("expected normalized tags, got %v", created.Tags)
+	}
+
+	update := func(body string) models.Todo {
+		req := httptest.NewRequest(http.MethodPut, "/todo/update/1", strings.NewReader(body))
+		req.SetPathValue("id", "1")
+		w := httptest.NewRecorder()
+		s.updateTodoHandler(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", w.Code)
+		}
+		var todo models.Todo
+		if err := json.NewDecoder(w.Body).Decode(&todo); err != nil {
+			t.Fatalf("could not decode response: %v", err)
+		}
+		return todo
+	}
+
+	kept := update(`{"title":"Test","description":"Test Desc","completed":false}`)
+	if !reflect.DeepEqual(kept.Tags, created.Tags) {
+		t.Errorf("expected tags to be kept when omitted, got %v", kept.Tags)
+	}
+
+	cleared := update(`{"title":"Test","description":"Test Desc","completed":false,"tags":[]}`)
+	if len(cleared.Tags) != 0 {
+		t.Errorf("expected tags to be cleared, got %v", cleared.Tags)
+	}
+}
+
+func TestUpdateTodoHandlerCompletedAt(t *testing.T) {
+	s := newTestServer(t)
+	existing := createTestTodo(s, models.Todo{Title: "Test", Description: "Test Desc"})
+	if existing.CreatedAt.IsZero() || existing.UpdatedAt.IsZero() || existing.CompletedAt != nil {
+		t.Fatalf("unexpected timestamps on created todo: %+v", existing)
+	}
+
+	update := func(completed bool) models.Todo {
+		body := fmt.Sprintf(`{"title":"Test","description":"Test Desc","completed":%t}`, completed)
+		req := httptest.NewRequest(http.MethodPut, "/todo/update/1", strings.NewReader(body))
+		req.SetPathValue("id", "1")
+		w := httptest.NewRecorder()
+		s.updateTodoHandler(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", w.Code)
+		}
+		var todo models.Todo
+		if err := json.NewDecoder(w.Body).Decode(&todo); err != nil {
+			t.Fatalf("could not decode response: %v", err)
+		}
+		return todo
+	}
+
+	completed := update(true)
+	if completed.CompletedAt == nil {
+		t.Fatalf("expected completed_at to be set after completing")
+	}
+	if !completed.CreatedAt.Equal(existing.CreatedAt) {
+		t.Errorf("expected created_at to stay %v, got %v", existing.CreatedAt, completed.CreatedAt)
+	}
+
+	reopened := update(false)
+	if reopened.CompletedAt != nil {
+		t.Errorf("expected completed_at to be cleared after reopening, got %v", reopened.CompletedAt)
+	}
+}
+
+func TestSubtaskHandlers(t *testing.T) {
+	s := newTestServer(t)
+	handler := s.RegisterRoutes()
+
+	parent := createTestTodo(s, models.Todo{Title: "Release", Description: "Ship v2"})
+	child := createTestTodo(s, models.Todo{Title: "Changelog", Description: "Write it", ParentID: &parent.ID})
+	grandchild := createTestTodo(s, models.Todo{Title: "Collect PRs", Description: "From git log", ParentID: &child.ID})
+
+	// Children
+	req := httptest.NewRequest(http.MethodGet, "/todos/1/children", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	var children []models.Todo
+	if err := json.NewDecoder(w.Body).Decode(&children); err != nil {
+		t.Fatalf("could not decode response: %v", err)
+	}
+	if len(children) != 1 || children[0].ID != child.ID {
+		t.Errorf("expected only the direct child %d, got %+v", child.ID, children)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/todos/42/children", nil)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for unknown todo, got %d", w.Code)
+	}
+
+	// Tree
+	req = httptest.NewRequest(http.MethodGet, "/todos/1/tree", nil)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	var tree models.TodoNode
+	if err := json.NewDecoder(w.Body).Decode(&tree); err != nil {
+		t.Fatalf("could not decode response: %v", err)
+	}
+	if tree.ID != parent.ID || len(tree.Children) != 1 || tree.Children[0].ID != child.ID ||
+		len(tree.Children[0].Children) != 1 || tree.Children[0].Children[0].ID != grandchild.ID {
+		t.Errorf("unexpected tree: %+v", tree)
+	}
+	if tree.Progress == nil || *tree.Progress != 0 {
+		t.Errorf("expected progress 0, got %v", tree.Progress)
+	}
+
+	// Cycle
+	body := fmt.Sprintf(`{"title":"Release","description":"Ship v2","completed":false,"parent_id":%d}`, grandchild.ID)
+	req = httptest.NewRequest(http.MethodPut, "/todo/update/1", strings.NewReader(body))
+	req.SetPathValue("id", "1")
+	w = httptest.NewRecorder()
+	s.updateTodoHandler(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for cyclic parent, got %d", w.Code)
+	}
+}
+
+func TestUpdateTodoHandlerSubtaskCompletion(t *testing.T) {
+	tests := []struct {
+		rule           subtaskCompletion
+		wantStatus     int
+		wantChildDone  bool
+		wantParentDone bool
+	}{
+		{"", http.StatusOK, false, true},
+		{subtasksIndependent, http.StatusOK, false, true},
+		{subtasksCascade, http.StatusOK, true, true},
+		{subtasksRequired, http.StatusConflict, false, false},
+	}
+	for _, tt := range tests {
+		s := newTestServer(t)
+		s.subtaskCompletion = tt.rule
+		parent := createTestTodo(s, models.Todo{Title: "Release", Description: "Ship v2"})
+		child := createTestTodo(s, models.Todo{Title: "Changelog", Description: "Write it", ParentID: &parent.ID})
+
+		body := `{"title":"Release","description":"Ship v2","completed":true}`
+		req := httptest.NewRequest(http.MethodPut, "/todo/update/1", strings.NewReader(body))
+		req.SetPathValue("id", "1")
+		w := httptest.NewRecorder()
+		s.updateTodoHandler(w, req)
+
+		if w.Code != tt.wantStatus {
+			t.Errorf("%q: expected status %d, got %d", tt.rule, tt.wantStatus, w.Code)
+		}
+		if got := getTestTodo(t, s, parent.ID).Completed; got != tt.wantParentDone {
+			t.Errorf("%q: expected parent completed=%t, got %t", tt.rule, tt.wantParentDone, got)
+		}
+		if got := getTestTodo(t, s, child.ID).Completed; got != tt.wantChildDone {
+			t.Errorf("%q: expected child completed=%t, got %t", tt.rule, tt.wantChildDone, got)
+		}
+	}
+}
+
+func TestUpdateTodoHandlerRecurring(t *testing.T) {
+	s := newTestServer(t)
+	body := `{"title":"Weekly report","description":"Send it","completed":false,` +
+		`"start_at":"2025-06-05T09:00:00Z","due_at":"2025-06-06T17:00:00Z","recurrence":"FREQ=WEEKLY;COUNT=3","tags":["reports"]}`
+	req := httptest.NewRequest(http.MethodPost, "/todo/create", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	s.createTodoHandler(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d", w.Code)
+	}
+
+	body = strings.Replace(body, `"completed":false`, `"completed":true`, 1)
+	req = httptest.NewRequest(http.MethodPut, "/todo/update/1", strings.NewReader(body))
+	req.SetPathValue("id", "1")
+	w = httptest.NewRecorder()
+	s.updateTodoHandler(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	if n := countTestTodos(t, s); n != 2 {
+		t.Fatalf("expected the next occurrence to be created, got %d todos", n)
+	}
+	if completed := getTestTodo(t, s, 1); completed.Recurrence != "" {
+		t.Errorf("expected the completed todo to hand over its recurrence, got %q", completed.Recurrence)
+	}
+	next := getTestTodo(t, s, 2)
+	wantDue := time.Date(2025, 6, 13, 17, 0, 0, 0, time.UTC)
+	wantStart := time.Date(2025, 6, 12, 9, 0, 0, 0, time.UTC)
+	if next.Completed || next.DueAt == nil || !next.DueAt.Equal(wantDue) || next.StartAt == nil || !next.StartAt.Equal(wantStart) {
+		t.Errorf("unexpected next occurrence: %+v", next)
+	}
+	if next.Recurrence != "FREQ=WEEKLY;COUNT=2" || !reflect.DeepEqual(next.Tags, []string{"reports"}) {
+		t.Errorf("unexpected next occurrence: %+v", next)
+	}
+
+	// Preview
+	req = httptest.NewRequest(http.MethodGet, "/todos/2/occurrences?count=5", nil)
+	w = httptest.NewRecorder()
+	s.RegisterRoutes().ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	var occurrences []time.Time
+	if err := json.NewDecoder(w.Body).Decode(&occurrences); err != nil {
+		t.Fatalf("could not decode response: %v", err)
+	}
+	if len(occurrences) != 1 || !occurrences[0].Equal(wantDue.AddDate(0, 0, 7)) {
+		t.Errorf("expected the single remaining occurrence, got %v", occurrences)
+	}
+}
+
+func TestCreateTodoHandlerInvalidRecurrence(t *testing.T) {
+	for _, body := range []string{
+		`{"title":"Report","description":"Send it","completed":false,"due_at":"2025-06-06T17:00:00Z","recurrence":"FREQ=HOURLY"}`,
+		`{"title":"Report","description":"Send it","completed":false,"recurrence":"weekly"}`,
+	} {
+		s := newTestServer(t)
+		req := httptest.NewRequest(http.MethodPost, "/todo/create", strings.NewReader(body))
+		w := httptest.NewRecorder()
+
+		s.createTodoHandler(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", body, w.Code)
+		}
+	}
+}
+
 func TestDeleteTodoHandler(t *testing.T) {
-	s := &Server{db: newMockDBService()}
+	s := newTestServer(t)
 	created := createTestTodo(s, models.Todo{Title: "Test", Description: "Test Desc", Completed: false})
 
 	req := httptest.NewRequest(http.MethodDelete, "/todos/1", nil)
+	req.SetPathValue("id", "1")
 	w := httptest.NewRecorder()
 
 	s.deleteTodoHandler(w, req)
@@ -169,12 +552,146 @@ func TestDeleteTodoHandler(t *testing.T) {
 		t.Fatalf("expected status 204, got %d", resp.StatusCode)
 	}
 
-	_, err := s.db.GetTodo(created.ID)
+	_, err := s.db.GetTodo(context.Background(), created.ID)
 	if err == nil {
 		t.Fatalf("expected error after deleting todo, got nil")
 	}
 }
 
+func patchTestTodo(s *Server, id int, patch string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPatch, fmt.Sprintf("/todos/%d", id), strings.NewReader(patch))
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	req.SetPathValue("id", strconv.Itoa(id))
+	w := httptest.NewRecorder()
+	s.patchTodoHandler(w, req)
+	return w
+}
+
+func TestPatchTodoHandler(t *testing.T) {
+	s := newTestServer(t)
+	dueAt := time.Date(2025, 6, 1, 9, 0, 0, 0, time.UTC)
+	created := createTestTodo(s, models.Todo{Title: "Report", Description: "Quarterly", Priority: 2, DueAt: &dueAt, Tags: []string{"work"}})
+
+	w := patchTestTodo(s, created.ID, `{"completed": true}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var patched models.Todo
+	if err := json.NewDecoder(w.Body).Decode(&patched); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if !patched.Completed || patched.Title != "Report" || patched.Priority != 2 || patched.DueAt == nil || !slices.Equal(patched.Tags, []string{"work"}) {
+		t.Errorf("expected only completed to change, got %+v", patched)
+	}
+	if fields := changedTestFields(t, s, created.ID); !slices.Equal(fields, []string{"completed", "completed_at"}) {
+		t.Errorf("expected only completed to be written, got %v", fields)
+	}
+
+	w = patchTestTodo(s, created.ID, `{"due_at": null, "priority": null, "tags": ["Home", "home"], "title": "Annual report"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	stored := getTestTodo(t, s, created.ID)
+	if stored.DueAt != nil || stored.Priority != 0 || stored.Title != "Annual report" || !slices.Equal(stored.Tags, []string{"home"}) {
+		t.Errorf("unexpected todo after patch: %+v", stored)
+	}
+	if fields := changedTestFields(t, s, created.ID); !slices.Equal(fields, []string{"title", "priority", "due_at", "tags"}) {
+		t.Errorf("unexpected patched fields %v", fields)
+	}
+}
+
+func TestPatchTodoHandlerInvalid(t *testing.T) {
+	s := newTestServer(t)
+	dueAt := time.Date(2025, 6, 1, 9, 0, 0, 0, time.UTC)
+	created := createTestTodo(s, models.Todo{Title: "Report", Description: "Quarterly", DueAt: &dueAt, Recurrence: "weekly"})
+
+	tests := []struct {
+		patch string
+		want  int
+	}{
+		{`[{"op": "replace", "path": "/title", "value": "x"}]`, http.StatusBadRequest},
+		{`{"id": 7}`, http.StatusBadRequest},
+		{`{"created_at": null}`, http.StatusBadRequest},
+		{`{"title": null}`, http.StatusBadRequest},
+		{`{"title": ""}`, http.StatusBadRequest},
+		{`{"priority": 9}`, http.StatusBadRequest},
+		{`{"priority": "high"}`, http.StatusBadRequest},
+		{`{"due_at": null}`, http.StatusBadRequest},
+		{`{"start_at": "2025-07-01T00:00:00Z"}`, http.StatusBadRequest},
+		{`{"tags": ["late\u0007"]}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if w := patchTestTodo(s, created.ID, tt.patch); w.Code != tt.want {
+			t.Errorf("%s: expected status %d, got %d", tt.patch, tt.want, w.Code)
+		}
+	}
+
+	if w := patchTestTodo(s, 42, `{"completed": true}`); w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for unknown todo, got %d", w.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodPatch, "/todos/1", strings.NewReader(`{"completed": true}`))
+	req.Header.Set("Content-Type", "text/plain")
+	req.SetPathValue("id", "1")
+	w := httptest.NewRecorder()
+	s.patchTodoHandler(w, req)
+	if w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("expected status 415, got %d", w.Code)
+	}
+}
+
+func TestPatchTodoHandlerRecurring(t *testing.T) {
+	s := newTestServer(t)
+	dueAt := time.Date(2025, 6, 2, 9, 0, 0, 0, time.UTC)
+	created := createTestTodo(s, models.Todo{Title: "Standup", Description: "Daily", DueAt: &dueAt, Recurrence: "daily"})
+
+	if w := patchTestTodo(s, created.ID, `{"completed": true}`); w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if fields := changedTestFields(t, s, created.ID); !slices.Equal(fields, []string{"completed", "completed_at", "recurrence"}) {
+		t.Errorf("expected the recurrence to be handed over, got fields %v", fields)
+	}
+	if n := countTestTodos(t, s); n != 2 {
+		t.Errorf("expected the next occurrence to be created, got %d todos", n)
+	}
+}
+
+func TestNextOccurrenceAcrossDST(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("time zone data unavailable: %v", err)
+	}
+	defer func(loc *time.Location) { recurrenceLocation = loc }(recurrenceLocation)
+	recurrenceLocation = newYork
+
+	// 9:00 in New York on the day before clocks go forward, as read back
+	// from the database.
+	dueAt := time.Date(2025, 3, 8, 14, 0, 0, 0, time.UTC)
+	for rule, want := range map[string]time.Time{
+		"daily":  time.Date(2025, 3, 9, 13, 0, 0, 0, time.UTC),
+		"weekly": time.Date(2025, 3, 15, 13, 0, 0, 0, time.UTC),
+	} {
+		next, ok := nextOccurrence(models.Todo{Title: "Standup", DueAt: &dueAt, Recurrence: rule})
+		if !ok || !next.DueAt.Equal(want) {
+			t.Errorf("%s: expected the next occurrence at 9:00 local time (%v), got %v", rule, want, next.DueAt)
+		}
+	}
+}
+
+// changedTestFields returns the fields changed by the last write of a todo.
+func changedTestFields(t *testing.T, s *Server, id int) []string {
+	t.Helper()
+	history, err := s.db.GetTodoHistory(context.Background(), id)
+	if err != nil || len(history) == 0 {
+		t.Fatalf("failed to get the history of todo %d: %v", id, err)
+	}
+	var fields []string
+	for _, change := range history[0].Changes {
+		fields = append(fields, change.Field)
+	}
+	return fields
+}
+
 func createTestTodo(s *Server, todo models.Todo) models.Todo {
 	body, _ := json.Marshal(todo)
 	req := httptest.NewRequest(http.MethodPost, "/todos", strings.NewReader(string(body)))
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"go-todo/internal/database"
+	"go-todo/internal/models"
+	"mime"
+	"net/http"
+	"slices"
+	"time"
+)
+
+const mergePatchType = "application/merge-patch+json"
+
+// applyMergePatch applies an RFC 7396 JSON merge patch to todo and returns
+// the names of the fields it changes. Every todo field is a plain value, so a
+// member of the patch replaces the field and null resets it; title and
+// completed cannot be reset.
+func applyMergePatch(todo *models.Todo, patch []byte) ([]string, error) {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(patch, &members); err != nil || members == nil {
+		return nil, &apiError{http.StatusBadRequest, "invalid_payload", "Patch must be a JSON object", nil}
+	}
+
+	fields := make([]string, 0, len(members))
+	for field, value := range members {
+		if !database.PatchableTodoField(field) {
+			return nil, invalidField(field, "cannot be patched")
+		}
+		fields = append(fields, field)
+
+		if string(value) == "null" {
+			switch field {
+			case "title", "completed":
+				return nil, invalidField(field, "must not be null")
+			case "description":
+				todo.Description = ""
+			case "priority":
+				todo.Priority = 0
+			case "start_at":
+				todo.StartAt = nil
+			case "due_at":
+				todo.DueAt = nil
+			case "tags":
+				todo.Tags = []string{}
+			case "project_id":
+				todo.ProjectID = nil
+			case "parent_id":
+				todo.ParentID = nil
+			case "recurrence":
+				todo.Recurrence = ""
+			}
+			continue
+		}
+
+		var target any
+		switch field {
+		case "title":
+			target = &todo.Title
+		case "description":
+			target = &todo.Description
+		case "completed":
+			target = &todo.Completed
+		case "priority":
+			target = &todo.Priority
+		case "start_at":
+			todo.StartAt = new(time.Time)
+			target = todo.StartAt
+		case "due_at":
+			todo.DueAt = new(time.Time)
+			target = todo.DueAt
+		case "tags":
+			target = &todo.Tags
+		case "project_id":
+			todo.ProjectID = new(int)
+			target = todo.ProjectID
+		case "parent_id":
+			todo.ParentID = new(int)
+			target = todo.ParentID
+		case "recurrence":
+			target = &todo.Recurrence
+		}
+		if err := json.Unmarshal(value, target); err != nil {
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &typeErr) {
+				return nil, invalidField(field, "must be %s", jsonTypeName(typeErr.Type))
+			}
+			return nil, invalidField(field, "is invalid")
+		}
+	}
+	// Sort for deterministic UPDATE statements and log output.
+	slices.Sort(fields)
+	return fields, nil
+}
+
+// validatePatchedTodo checks a todo after a patch has been applied to it, using
+// the same rules as a full update, and normalizes it. Tags are only checked
+// when the patch changes them.
+func validatePatchedTodo(todo *models.Todo, fields []string) error {
+	var v validator
+	if slices.Contains(fields, "tags") {
+		todo.Tags = validateTags(&v, todo.Tags)
+	}
+	validateTodo(&v, todo)
+	return v.err()
+}
+
+// isMergePatch reports whether r carries a JSON merge patch. Plain JSON is
+// accepted as well for clients that cannot set the media type.
+func isMergePatch(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && (mediaType == mergePatchType || mediaType == "application/json")
+}
@@ -0,0 +1,195 @@
+package server
+
+import (
+	"fmt"
+	"go-todo/internal/database"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// parseTodoFilter builds a database.TodoFilter from the query string of a
+// GET /todos request.
+//
+//	?due=overdue     open todos past their due date
+//	?due=today       todos due today
+//	?due_within=N    todos due within the next N days
+//	?tag=a&tag=b     todos carrying tag a or b
+//	?tag_match=all   todos carrying every requested tag instead
+//	?project_id=N    todos of project N
+//	?include=archived
+//	                 archived todos as well, which are left out otherwise
+//	?completed=false open todos
+//	?due_after=2024-05-01&due_before=2024-06-01
+//	                 todos due within the range, and likewise created_after
+//	                 and created_before; times are dates or RFC 3339
+//	?contains=text   todos whose title or description contains text
+//	?filter=completed:false AND priority>=2
+//	                 todos matching a filter expression, see database.ParseFilter
+//	?sort=-priority,due_at
+//	                 order by the listed fields, descending if prefixed with "-"
+func parseTodoFilter(r *http.Request) (database.TodoFilter, error) {
+	var filter database.TodoFilter
+	q := r.URL.Query()
+
+	switch due := q.Get("due"); due {
+	case "":
+	case string(database.DueOverdue), string(database.DueToday):
+		filter.Due = database.DueFilter(due)
+	default:
+		return filter, fmt.Errorf("invalid due filter %q", due)
+	}
+
+	if within := q.Get("due_within"); within != "" {
+		if filter.Due != database.DueAny {
+			return filter, fmt.Errorf("due and due_within cannot be combined")
+		}
+		days, err := strconv.Atoi(within)
+		if err != nil || days < 0 {
+			return filter, fmt.Errorf("invalid due_within value %q", within)
+		}
+		filter.Due = database.DueWithin
+		filter.DueWithinDays = days
+	}
+
+	if tags := normalizeTags(q["tag"]); len(tags) > 0 {
+		filter.Tags = tags
+	}
+	switch match := q.Get("tag_match"); match {
+	case "":
+	case string(database.TagMatchAny), string(database.TagMatchAll):
+		filter.TagMatch = database.TagMatch(match)
+	default:
+		return filter, fmt.Errorf("invalid tag_match value %q", match)
+	}
+
+	if project := q.Get("project_id"); project != "" {
+		id, err := strconv.Atoi(project)
+		if err != nil {
+			return filter, fmt.Errorf("invalid project_id value %q", project)
+		}
+		filter.ProjectID = &id
+	}
+
+	if completed := q.Get("completed"); completed != "" {
+		value, err := strconv.ParseBool(completed)
+		if err != nil {
+			return filter, fmt.Errorf("invalid completed value %q", completed)
+		}
+		filter.Completed = &value
+	}
+
+	ranges := []struct {
+		param string
+		bound **time.Time
+	}{
+		{"due_after", &filter.DueRange.After},
+		{"due_before", &filter.DueRange.Before},
+		{"created_after", &filter.CreatedRange.After},
+		{"created_before", &filter.CreatedRange.Before},
+	}
+	for _, r := range ranges {
+		if value := q.Get(r.param); value != "" {
+			t, err := database.ParseFilterTime(value)
+			if err != nil {
+				return filter, invalidField(r.param, "must be a date or an RFC 3339 timestamp")
+			}
+			*r.bound = &t
+		}
+	}
+
+	filter.Contains = strings.TrimSpace(q.Get("contains"))
+
+	if expr := q.Get("filter"); expr != "" {
+		parsed, err := database.ParseFilter(expr)
+		if err != nil {
+			return filter, invalidField("filter", "is invalid: %v", err)
+		}
+		filter.Expr = parsed
+	}
+
+	archived, err := parseInclude(r)
+	if err != nil {
+		return filter, err
+	}
+	filter.Archived = archived
+
+	if sort := q.Get("sort"); sort != "" {
+		keys, err := parseTodoSort(sort)
+		if err != nil {
+			return filter, err
+		}
+		filter.Sort = keys
+	}
+
+	return filter, nil
+}
+
+// parseInclude parses the include query parameter, which lists archived
+// todos as well when it is "archived".
+func parseInclude(r *http.Request) (database.ArchiveFilter, error) {
+	switch include := r.URL.Query().Get("include"); include {
+	case "":
+		return database.ArchivedExclude, nil
+	case "archived":
+		return database.ArchivedInclude, nil
+	default:
+		return "", fmt.Errorf("invalid include value %q", include)
+	}
+}
+
+// parseTodoSort parses a comma-separated list of sort fields such as
+// "-priority,due_at".
+func parseTodoSort(value string) ([]database.SortKey, error) {
+	var keys []database.SortKey
+	seen := make(map[database.SortField]bool)
+	for _, term := range strings.Split(value, ",") {
+		term = strings.TrimSpace(term)
+		key := database.SortKey{Field: database.SortField(strings.TrimPrefix(term, "-")), Desc: strings.HasPrefix(term, "-")}
+		if !database.ValidSortField(key.Field) {
+			return nil, fmt.Errorf("invalid sort field %q", term)
+		}
+		if seen[key.Field] {
+			return nil, fmt.Errorf("duplicate sort field %q", key.Field)
+		}
+		seen[key.Field] = true
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// parsePage reads the ?limit= and ?cursor= parameters. paged is false if
+// neither is given, in which case the whole list is returned.
+func parsePage(r *http.Request) (limit int, cursor string, paged bool, err error) {
+	q := r.URL.Query()
+	if !q.Has("limit") && !q.Has("cursor") {
+		return 0, "", false, nil
+	}
+
+	limit = defaultPageSize
+	if value := q.Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			return 0, "", false, fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+		}
+	}
+	return limit, q.Get("cursor"), true, nil
+}
+
+// setNextPage advertises the page following the current request in the
+// X-Next-Cursor header and an RFC 8288 Link header.
+func setNextPage(w http.ResponseWriter, r *http.Request, cursor string) {
+	q := r.URL.Query()
+	q.Set("cursor", cursor)
+	next := url.URL{Path: r.URL.Path, RawQuery: q.Encode()}
+
+	w.Header().Set("X-Next-Cursor", cursor)
+	w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, next.String()))
+}
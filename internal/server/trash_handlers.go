@@ -0,0 +1,110 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"go-todo/internal/database"
+	"go-todo/internal/models"
+	"log"
+	"net/http"
+)
+
+var errParentInTrash = &apiError{http.StatusConflict, "parent_in_trash", "The parent todo is in the trash; restore it first", nil}
+
+// @Summary List the trash
+// @Description List the deleted todos, most recently deleted first. They are purged for good once
+// @Description the retention period has passed.
+// @Tags trash
+// @Produce json
+// @Success 200 {array} models.Todo
+// @Router /trash [get]
+func (s *Server) getTrashHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("GET %s from %s", r.URL.Path, r.RemoteAddr)
+	todos, err := s.db.GetTrash(r.Context())
+	if err != nil {
+		log.Printf("getTrashHandler: failed to fetch trash: %v", err)
+		writeError(w, r, err)
+		return
+	}
+	if todos == nil {
+		todos = []models.Todo{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(todos); err != nil {
+		log.Printf("getTrashHandler: failed to write response: %v", err)
+	}
+}
+
+// @Summary Restore a deleted todo
+// @Description Take a todo out of the trash together with the subtasks that were deleted with it
+// @Tags trash
+// @Produce json
+// @Param id path int true "Todo ID"
+// @Success 200 {object} models.Todo
+// @Failure 400 {object} problem "Invalid request"
+// @Failure 404 {object} problem "Todo not in the trash"
+// @Failure 409 {object} problem "Parent todo is in the trash"
+// @Router /todos/{id}/restore [post]
+func (s *Server) restoreTodoHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("POST %s from %s", r.URL.Path, r.RemoteAddr)
+	id, err := parsePathID(r, "id")
+	if err != nil {
+		log.Printf("restoreTodoHandler: invalid ID: %v", err)
+		writeError(w, r, badRequest(err))
+		return
+	}
+
+	ctx := r.Context()
+	var todo models.Todo
+	err = s.db.WithTx(ctx, s.txIsolation, func(tx database.Store) error {
+		if err := tx.RestoreTodo(ctx, id); err != nil {
+			if errors.Is(err, database.ErrInvalidReference) {
+				return errParentInTrash
+			}
+			return lookupError("Todo", err)
+		}
+		var err error
+		todo, err = tx.GetTodo(ctx, id)
+		return err
+	})
+	if err != nil {
+		log.Printf("restoreTodoHandler: failed to restore todo with id %d: %v", id, err)
+		writeError(w, r, err)
+		return
+	}
+
+	log.Printf("restoreTodoHandler: restored todo with id %d", id)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", todoETag(todo))
+	if err := json.NewEncoder(w).Encode(todo); err != nil {
+		log.Printf("restoreTodoHandler: failed to write response: %v", err)
+	}
+}
+
+// @Summary Purge a deleted todo
+// @Description Permanently delete a todo in the trash together with its subtasks
+// @Tags trash
+// @Param id path int true "Todo ID"
+// @Success 204
+// @Failure 400 {object} problem "Invalid request"
+// @Failure 404 {object} problem "Todo not in the trash"
+// @Router /trash/{id} [delete]
+func (s *Server) purgeTodoHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("DELETE %s from %s", r.URL.Path, r.RemoteAddr)
+	id, err := parsePathID(r, "id")
+	if err != nil {
+		log.Printf("purgeTodoHandler: invalid ID: %v", err)
+		writeError(w, r, badRequest(err))
+		return
+	}
+
+	if err := s.db.PurgeTodo(r.Context(), id); err != nil {
+		log.Printf("purgeTodoHandler: failed to purge todo with id %d: %v", id, err)
+		writeError(w, r, lookupError("Todo", err))
+		return
+	}
+
+	log.Printf("purgeTodoHandler: purged todo with id %d", id)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"go-todo/internal/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTrashHandlers(t *testing.T) {
+	s := newTestServer(t)
+	handler := s.RegisterRoutes()
+	parent := createTestTodo(s, models.Todo{Title: "Move"})
+	child := createTestTodo(s, models.Todo{Title: "Pack boxes", ParentID: &parent.ID})
+
+	do := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do(http.MethodDelete, "/todos/1"); w.Code != http.StatusNoContent {
+		t.Fatalf("expected status 204, got %d", w.Code)
+	}
+	if w := do(http.MethodGet, "/todos/1"); w.Code != http.StatusNotFound {
+		t.Errorf("expected a deleted todo to be gone, got %d", w.Code)
+	}
+	if w := do(http.MethodDelete, "/todos/1"); w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 when deleting a todo twice, got %d", w.Code)
+	}
+
+	w := do(http.MethodGet, "/trash")
+	var trash []models.Todo
+	if err := json.NewDecoder(w.Body).Decode(&trash); err != nil {
+		t.Fatalf("failed to decode trash: %v", err)
+	}
+	if len(trash) != 2 || trash[0].DeletedAt == nil {
+		t.Fatalf("expected the todo and its subtask in the trash, got %+v", trash)
+	}
+
+	w = do(http.MethodPost, "/todos/2/restore")
+	if p := decodeProblem(t, w); w.Code != http.StatusConflict || p.Code != "parent_in_trash" {
+		t.Errorf("expected status 409 parent_in_trash, got %d %+v", w.Code, p)
+	}
+	w = do(http.MethodPost, "/todos/1/restore")
+	var restored models.Todo
+	if err := json.NewDecoder(w.Body).Decode(&restored); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 with the restored todo, got %d: %v", w.Code, err)
+	}
+	if restored.ID != parent.ID || restored.DeletedAt != nil {
+		t.Errorf("unexpected restored todo %+v", restored)
+	}
+	if _, err := s.db.GetTodo(context.Background(), child.ID); err != nil {
+		t.Errorf("expected the subtask to be restored with its parent")
+	}
+	if w := do(http.MethodPost, "/todos/1/restore"); w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 restoring a todo outside the trash, got %d", w.Code)
+	}
+
+	do(http.MethodDelete, "/todos/2")
+	if w := do(http.MethodDelete, "/trash/2"); w.Code != http.StatusNoContent {
+		t.Errorf("expected status 204, got %d", w.Code)
+	}
+	if w := do(http.MethodPost, "/todos/2/restore"); w.Code != http.StatusNotFound {
+		t.Errorf("expected a purged todo to be gone, got %d", w.Code)
+	}
+	if w := do(http.MethodDelete, "/trash/1"); w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 purging a todo outside the trash, got %d", w.Code)
+	}
+}
+
+func TestPurgeTrash(t *testing.T) {
+	s := newTestServer(t)
+	s.trashRetention = 50 * time.Millisecond
+	ctx := context.Background()
+	old := createTestTodo(s, models.Todo{Title: "Old"})
+	recent := createTestTodo(s, models.Todo{Title: "Recent"})
+	if err := s.db.DeleteTodo(ctx, old.ID); err != nil {
+		t.Fatalf("DeleteTodo failed: %v", err)
+	}
+	time.Sleep(2 * s.trashRetention)
+	if err := s.db.DeleteTodo(ctx, recent.ID); err != nil {
+		t.Fatalf("DeleteTodo failed: %v", err)
+	}
+
+	// The trash is purged as soon as purgeTrash starts; it is stopped once the
+	// old todo is gone.
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		s.purgeTrash(ctx, time.Hour)
+		close(done)
+	}()
+	var trash []models.Todo
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		var err error
+		if trash, err = s.db.GetTrash(ctx); err != nil {
+			t.Fatalf("GetTrash failed: %v", err)
+		}
+		if len(trash) < 2 {
+			break
+		}
+	}
+	cancel()
+	<-done
+
+	if len(trash) != 1 || trash[0].ID != recent.ID {
+		t.Errorf("expected only the recently deleted todo to be kept, got %+v", trash)
+	}
+}
@@ -0,0 +1,197 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-todo/internal/models"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// maxBodyBytes limits the size of every JSON request body.
+	maxBodyBytes = 1 << 20
+
+	maxTitleLength       = 200
+	maxDescriptionLength = 10000
+	maxNameLength        = 100
+	maxTags              = 20
+	maxTagLength         = 50
+	maxRecurrenceLength  = 200
+)
+
+// validator collects field errors so that a request reports every invalid
+// field at once instead of only the first one.
+type validator struct {
+	fields []fieldError
+}
+
+// check records message for field unless ok holds.
+func (v *validator) check(ok bool, field, format string, args ...any) {
+	if !ok {
+		v.fields = append(v.fields, fieldError{field, fmt.Sprintf(format, args...)})
+	}
+}
+
+// merge records the field errors carried by err, as returned by helpers that
+// validate a single field such as validatePriority.
+func (v *validator) merge(err error) {
+	if err == nil {
+		return
+	}
+	var apiErr *apiError
+	if errors.As(err, &apiErr) && len(apiErr.fields) > 0 {
+		v.fields = append(v.fields, apiErr.fields...)
+		return
+	}
+	v.fields = append(v.fields, fieldError{"", err.Error()})
+}
+
+// checkText validates a free-text field. Only multiline fields may contain
+// line breaks and tabs; other control characters are never allowed.
+func (v *validator) checkText(field, value string, maxLength int, multiline bool) {
+	if n := utf8.RuneCountInString(value); n > maxLength {
+		v.check(false, field, "must be at most %d characters long, got %d", maxLength, n)
+	}
+	for _, c := range value {
+		if unicode.IsControl(c) && !(multiline && (c == '\n' || c == '\r' || c == '\t')) {
+			v.check(false, field, "must not contain control characters")
+			return
+		}
+	}
+}
+
+// err returns the validation error describing every recorded field, or nil.
+func (v *validator) err() error {
+	if len(v.fields) == 0 {
+		return nil
+	}
+	detail := "Invalid " + v.fields[0].Field
+	if len(v.fields) > 1 {
+		detail = fmt.Sprintf("%d invalid fields", len(v.fields))
+	}
+	return &apiError{http.StatusBadRequest, "validation_failed", detail, v.fields}
+}
+
+// validateTodo trims and normalizes the user-editable fields of todo and
+// checks them, including its recurrence rule against its due date.
+func validateTodo(v *validator, todo *models.Todo) {
+	todo.Title = strings.TrimSpace(todo.Title)
+	todo.Description = strings.TrimSpace(todo.Description)
+	v.check(todo.Title != "", "title", "is required")
+	v.checkText("title", todo.Title, maxTitleLength, false)
+	v.checkText("description", todo.Description, maxDescriptionLength, true)
+	v.merge(validatePriority(todo.Priority))
+	v.merge(validateSchedule(todo.StartAt, todo.DueAt))
+	v.check(todo.ProjectID == nil || *todo.ProjectID > 0, "project_id", "must be a positive integer")
+	v.check(todo.ParentID == nil || *todo.ParentID > 0, "parent_id", "must be a positive integer")
+
+	v.check(len(todo.Recurrence) <= maxRecurrenceLength, "recurrence", "must be at most %d characters long", maxRecurrenceLength)
+	if rule, err := normalizeRecurrence(todo.Recurrence, todo.DueAt); err != nil {
+		v.merge(err)
+	} else {
+		todo.Recurrence = rule
+	}
+}
+
+// validateTags checks the tag names of a payload and returns them normalized.
+func validateTags(v *validator, names []string) []string {
+	tags := normalizeTags(names)
+	v.check(len(tags) <= maxTags, "tags", "must not contain more than %d tags", maxTags)
+	for _, tag := range tags {
+		v.checkText("tags", tag, maxTagLength, false)
+	}
+	return tags
+}
+
+// validateTag checks the normalized name of tag.
+func validateTag(tag models.Tag) error {
+	var v validator
+	v.check(tag.Name != "", "name", "is required")
+	v.checkText("name", tag.Name, maxTagLength, false)
+	return v.err()
+}
+
+// validateProject trims the name and description of project and checks them.
+func validateProject(project *models.Project) error {
+	var v validator
+	project.Name = strings.TrimSpace(project.Name)
+	project.Description = strings.TrimSpace(project.Description)
+	v.check(project.Name != "", "name", "is required")
+	v.checkText("name", project.Name, maxNameLength, false)
+	v.checkText("description", project.Description, maxDescriptionLength, true)
+	return v.err()
+}
+
+// decodeJSON decodes the JSON body of r into dst. It rejects bodies larger
+// than maxBodyBytes, fields dst does not declare and trailing data, and
+// reports type mismatches for the offending field.
+func decodeJSON(w http.ResponseWriter, r *http.Request, dst any) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(dst)
+	if err == nil && dec.Decode(&struct{}{}) != io.EOF {
+		err = errors.New("unexpected data after the JSON value")
+	}
+	return payloadError(err)
+}
+
+// payloadError maps an error from decoding a request body to the problem
+// reported to the client.
+func payloadError(err error) error {
+	var tooLarge *http.MaxBytesError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &tooLarge):
+		return &apiError{http.StatusRequestEntityTooLarge, "payload_too_large",
+			fmt.Sprintf("Request body must not exceed %d bytes", tooLarge.Limit), nil}
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		return invalidField(typeErr.Field, "must be %s", jsonTypeName(typeErr.Type))
+	}
+	if name, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		if unquoted, err := strconv.Unquote(name); err == nil {
+			name = unquoted
+		}
+		return invalidField(name, "is not allowed")
+	}
+	return errInvalidPayload
+}
+
+// jsonTypeName describes the JSON value expected for t.
+func jsonTypeName(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "an integer"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	}
+	return "an object"
+}
+
+// todoReadOnly declares the server-managed fields of a todo. Payloads accept
+// them so that a fetched todo can be sent back as is, but ignore their values.
+type todoReadOnly struct {
+	ID          json.RawMessage `json:"id" swaggerignore:"true"`
+	CreatedAt   json.RawMessage `json:"created_at" swaggerignore:"true"`
+	UpdatedAt   json.RawMessage `json:"updated_at" swaggerignore:"true"`
+	CompletedAt json.RawMessage `json:"completed_at" swaggerignore:"true"`
+	Progress    json.RawMessage `json:"progress" swaggerignore:"true"`
+	Version     json.RawMessage `json:"version" swaggerignore:"true"`
+	ArchivedAt  json.RawMessage `json:"archived_at" swaggerignore:"true"`
+	DeletedAt   json.RawMessage `json:"deleted_at" swaggerignore:"true"`
+}
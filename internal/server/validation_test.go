@@ -0,0 +1,122 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"go-todo/internal/models"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCreateTodoHandlerValidation(t *testing.T) {
+	s := newTestServer(t)
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		want   []fieldError
+	}{
+		{
+			name:   "unknown field",
+			body:   `{"title": "Report", "completed": false, "owner": "me"}`,
+			status: http.StatusBadRequest,
+			want:   []fieldError{{"owner", "is not allowed"}},
+		},
+		{
+			name:   "type mismatch",
+			body:   `{"title": "Report", "completed": "no"}`,
+			status: http.StatusBadRequest,
+			want:   []fieldError{{"completed", "must be a boolean"}},
+		},
+		{
+			name:   "title too long",
+			body:   fmt.Sprintf(`{"title": %q, "completed": false}`, strings.Repeat("é", maxTitleLength+1)),
+			status: http.StatusBadRequest,
+			want:   []fieldError{{"title", "must be at most 200 characters long, got 201"}},
+		},
+		{
+			name:   "control characters",
+			body:   `{"title": "Line\nbreak", "description": "Bell\u0007", "completed": false}`,
+			status: http.StatusBadRequest,
+			want: []fieldError{
+				{"title", "must not contain control characters"},
+				{"description", "must not contain control characters"},
+			},
+		},
+		{
+			name:   "every invalid field",
+			body:   `{"title": "", "priority": 5, "project_id": 0, "tags": ["a\tb"]}`,
+			status: http.StatusBadRequest,
+			want: []fieldError{
+				{"completed", "is required"},
+				{"tags", "must not contain control characters"},
+				{"title", "is required"},
+				{"priority", "must be between 0 and 4"},
+				{"project_id", "must be a positive integer"},
+			},
+		},
+		{
+			name:   "trailing data",
+			body:   `{"title": "Report", "completed": false} {}`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "body too large",
+			body:   fmt.Sprintf(`{"title": "Report", "completed": false, "description": %q}`, strings.Repeat("x", maxBodyBytes)),
+			status: http.StatusRequestEntityTooLarge,
+		},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/todos", strings.NewReader(tt.body))
+		w := httptest.NewRecorder()
+		s.createTodoHandler(w, req)
+
+		if w.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.status, w.Code)
+			continue
+		}
+		if p := decodeProblem(t, w); tt.want != nil && !reflect.DeepEqual(p.Errors, tt.want) {
+			t.Errorf("%s: expected errors %+v, got %+v", tt.name, tt.want, p.Errors)
+		}
+	}
+}
+
+func TestCreateTodoHandlerTrimsFields(t *testing.T) {
+	s := newTestServer(t)
+	req := httptest.NewRequest(http.MethodPost, "/todos", strings.NewReader(`{"title": "  Report  ", "description": "Line one\nLine two\n", "completed": false}`))
+	w := httptest.NewRecorder()
+	s.createTodoHandler(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status 201 without a description, got %d: %s", w.Code, w.Body.String())
+	}
+	var created models.Todo
+	if err := json.NewDecoder(w.Body).Decode(&created); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if created.Title != "Report" || created.Description != "Line one\nLine two" {
+		t.Errorf("expected trimmed fields, got %q and %q", created.Title, created.Description)
+	}
+}
+
+func TestProjectAndTagValidation(t *testing.T) {
+	s := newTestServer(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/projects", strings.NewReader(fmt.Sprintf(`{"name": %q}`, strings.Repeat("p", maxNameLength+1))))
+	w := httptest.NewRecorder()
+	s.createProjectHandler(w, req)
+	if w.Code != http.StatusBadRequest || decodeProblem(t, w).Errors[0].Field != "name" {
+		t.Errorf("expected a name error for a long project name, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/tags", strings.NewReader(`{"name": "work", "color": "red"}`))
+	w = httptest.NewRecorder()
+	s.createTagHandler(w, req)
+	if w.Code != http.StatusBadRequest || decodeProblem(t, w).Errors[0].Field != "color" {
+		t.Errorf("expected an unknown field error, got %d", w.Code)
+	}
+}
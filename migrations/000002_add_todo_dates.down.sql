@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS todos_due_at_idx;
+
+ALTER TABLE todos
+    DROP COLUMN IF EXISTS due_at,
+    DROP COLUMN IF EXISTS start_at;
@@ -0,0 +1,5 @@
+ALTER TABLE todos
+    ADD COLUMN IF NOT EXISTS start_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS due_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS todos_due_at_idx ON todos (due_at);
@@ -0,0 +1,7 @@
+DROP TRIGGER IF EXISTS todos_set_timestamps ON todos;
+DROP FUNCTION IF EXISTS todos_set_timestamps();
+
+ALTER TABLE todos
+    DROP COLUMN IF EXISTS completed_at,
+    DROP COLUMN IF EXISTS updated_at,
+    DROP COLUMN IF EXISTS created_at;
@@ -0,0 +1,34 @@
+ALTER TABLE todos
+    ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ADD COLUMN IF NOT EXISTS completed_at TIMESTAMPTZ;
+
+UPDATE todos SET completed_at = updated_at WHERE completed AND completed_at IS NULL;
+
+-- Keeps the audit timestamps in sync no matter which client writes the row.
+CREATE OR REPLACE FUNCTION todos_set_timestamps() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        NEW.created_at := now();
+        NEW.updated_at := NEW.created_at;
+        NEW.completed_at := CASE WHEN NEW.completed THEN NEW.created_at END;
+        RETURN NEW;
+    END IF;
+
+    NEW.created_at := OLD.created_at;
+    NEW.updated_at := now();
+    IF NOT NEW.completed THEN
+        NEW.completed_at := NULL;
+    ELSIF NOT OLD.completed THEN
+        NEW.completed_at := NEW.updated_at;
+    ELSE
+        NEW.completed_at := OLD.completed_at;
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS todos_set_timestamps ON todos;
+CREATE TRIGGER todos_set_timestamps
+    BEFORE INSERT OR UPDATE ON todos
+    FOR EACH ROW EXECUTE FUNCTION todos_set_timestamps();
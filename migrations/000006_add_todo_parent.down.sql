@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS todos_parent_id_idx;
+
+ALTER TABLE todos
+    DROP CONSTRAINT IF EXISTS todos_parent_not_self,
+    DROP COLUMN IF EXISTS parent_id;
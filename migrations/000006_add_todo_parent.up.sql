@@ -0,0 +1,15 @@
+ALTER TABLE todos
+    ADD COLUMN IF NOT EXISTS parent_id INTEGER REFERENCES todos (id) ON DELETE CASCADE;
+
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM pg_constraint
+        WHERE conname = 'todos_parent_not_self' AND conrelid = 'todos'::regclass
+    ) THEN
+        ALTER TABLE todos ADD CONSTRAINT todos_parent_not_self CHECK (parent_id <> id);
+    END IF;
+END
+$$;
+
+CREATE INDEX IF NOT EXISTS todos_parent_id_idx ON todos (parent_id);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS todos_priority_idx;
+
+ALTER TABLE todos
+    DROP CONSTRAINT IF EXISTS todos_priority_range,
+    DROP COLUMN IF EXISTS priority;
@@ -0,0 +1,15 @@
+ALTER TABLE todos
+    ADD COLUMN IF NOT EXISTS priority SMALLINT NOT NULL DEFAULT 0;
+
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM pg_constraint
+        WHERE conname = 'todos_priority_range' AND conrelid = 'todos'::regclass
+    ) THEN
+        ALTER TABLE todos ADD CONSTRAINT todos_priority_range CHECK (priority BETWEEN 0 AND 4);
+    END IF;
+END
+$$;
+
+CREATE INDEX IF NOT EXISTS todos_priority_idx ON todos (priority);
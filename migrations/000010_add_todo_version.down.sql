@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS todos_bump_version ON todos;
+DROP FUNCTION IF EXISTS todos_bump_version();
+
+ALTER TABLE todos DROP COLUMN IF EXISTS version;
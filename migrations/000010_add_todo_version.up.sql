@@ -0,0 +1,15 @@
+ALTER TABLE todos ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+
+-- Bumps the version on every write, including cascades such as a deleted
+-- project, so that clients holding an older ETag notice the change.
+CREATE OR REPLACE FUNCTION todos_bump_version() RETURNS trigger AS $$
+BEGIN
+    NEW.version := OLD.version + 1;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS todos_bump_version ON todos;
+CREATE TRIGGER todos_bump_version
+    BEFORE UPDATE ON todos
+    FOR EACH ROW EXECUTE FUNCTION todos_bump_version();
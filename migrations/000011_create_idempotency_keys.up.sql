@@ -0,0 +1,12 @@
+-- Responses to requests made with an Idempotency-Key, replayed when a client
+-- retries the same request. A status of 0 marks a request still in progress.
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    key TEXT PRIMARY KEY,
+    request_hash TEXT NOT NULL,
+    status INTEGER NOT NULL DEFAULT 0,
+    header JSONB NOT NULL DEFAULT '{}',
+    body BYTEA NOT NULL DEFAULT '',
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
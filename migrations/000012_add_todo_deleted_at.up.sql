@@ -0,0 +1,4 @@
+-- Deleted todos are kept as tombstones in the trash until they are purged.
+ALTER TABLE todos ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS todos_deleted_at_idx ON todos (deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,6 @@
+DROP TRIGGER IF EXISTS todos_unarchive_reopened ON todos;
+DROP FUNCTION IF EXISTS todos_unarchive_reopened();
+
+DROP INDEX IF EXISTS todos_archived_at_idx;
+
+ALTER TABLE todos DROP COLUMN IF EXISTS archived_at;
@@ -0,0 +1,19 @@
+-- Archived todos are completed todos moved out of the default listings.
+ALTER TABLE todos ADD COLUMN IF NOT EXISTS archived_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS todos_archived_at_idx ON todos (archived_at) WHERE archived_at IS NOT NULL;
+
+-- Reopening an archived todo brings it back into the default listings.
+CREATE OR REPLACE FUNCTION todos_unarchive_reopened() RETURNS trigger AS $$
+BEGIN
+    IF NOT NEW.completed THEN
+        NEW.archived_at := NULL;
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS todos_unarchive_reopened ON todos;
+CREATE TRIGGER todos_unarchive_reopened
+    BEFORE UPDATE ON todos
+    FOR EACH ROW EXECUTE FUNCTION todos_unarchive_reopened();
@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS todos_record_history ON todos;
+DROP FUNCTION IF EXISTS todos_record_history();
+
+DROP TABLE IF EXISTS todo_history;
@@ -0,0 +1,53 @@
+-- Every committed write of a todo is recorded as a revision with snapshots of
+-- the todo, including its tags, before and after the write.
+CREATE TABLE IF NOT EXISTS todo_history (
+    id BIGSERIAL PRIMARY KEY,
+    todo_id INTEGER NOT NULL REFERENCES todos (id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    operation TEXT NOT NULL,
+    changed_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    before JSONB,
+    after JSONB NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS todo_history_todo_id_idx ON todo_history (todo_id, id);
+
+-- Runs when the transaction commits, so that the snapshot includes the tags
+-- written after the todo itself.
+CREATE OR REPLACE FUNCTION todos_record_history() RETURNS trigger AS $$
+DECLARE
+    snapshot JSONB;
+    previous JSONB;
+    operation TEXT := 'create';
+BEGIN
+    -- The todo may have been purged later in the same transaction.
+    IF NOT EXISTS (SELECT 1 FROM todos WHERE id = NEW.id) THEN
+        RETURN NULL;
+    END IF;
+
+    snapshot := (to_jsonb(NEW) - 'search') || jsonb_build_object('tags', coalesce(
+        (SELECT jsonb_agg(t.name ORDER BY t.name) FROM todo_tags tt JOIN tags t ON t.id = tt.tag_id WHERE tt.todo_id = NEW.id),
+        '[]'::jsonb
+    ));
+
+    IF TG_OP = 'UPDATE' THEN
+        SELECT h.after INTO previous FROM todo_history h WHERE h.todo_id = NEW.id ORDER BY h.id DESC LIMIT 1;
+        previous := coalesce(previous, to_jsonb(OLD) - 'search');
+        operation := CASE
+            WHEN OLD.deleted_at IS NULL AND NEW.deleted_at IS NOT NULL THEN 'delete'
+            WHEN OLD.deleted_at IS NOT NULL AND NEW.deleted_at IS NULL THEN 'restore'
+            ELSE 'update'
+        END;
+    END IF;
+
+    INSERT INTO todo_history (todo_id, version, operation, before, after)
+    VALUES (NEW.id, NEW.version, operation, previous, snapshot);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS todos_record_history ON todos;
+CREATE CONSTRAINT TRIGGER todos_record_history
+    AFTER INSERT OR UPDATE ON todos
+    DEFERRABLE INITIALLY DEFERRED
+    FOR EACH ROW EXECUTE FUNCTION todos_record_history();
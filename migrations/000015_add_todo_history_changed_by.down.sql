@@ -0,0 +1,33 @@
+CREATE OR REPLACE FUNCTION todos_record_history() RETURNS trigger AS $$
+DECLARE
+    snapshot JSONB;
+    previous JSONB;
+    operation TEXT := 'create';
+BEGIN
+    -- The todo may have been purged later in the same transaction.
+    IF NOT EXISTS (SELECT 1 FROM todos WHERE id = NEW.id) THEN
+        RETURN NULL;
+    END IF;
+
+    snapshot := (to_jsonb(NEW) - 'search') || jsonb_build_object('tags', coalesce(
+        (SELECT jsonb_agg(t.name ORDER BY t.name) FROM todo_tags tt JOIN tags t ON t.id = tt.tag_id WHERE tt.todo_id = NEW.id),
+        '[]'::jsonb
+    ));
+
+    IF TG_OP = 'UPDATE' THEN
+        SELECT h.after INTO previous FROM todo_history h WHERE h.todo_id = NEW.id ORDER BY h.id DESC LIMIT 1;
+        previous := coalesce(previous, to_jsonb(OLD) - 'search');
+        operation := CASE
+            WHEN OLD.deleted_at IS NULL AND NEW.deleted_at IS NOT NULL THEN 'delete'
+            WHEN OLD.deleted_at IS NOT NULL AND NEW.deleted_at IS NULL THEN 'restore'
+            ELSE 'update'
+        END;
+    END IF;
+
+    INSERT INTO todo_history (todo_id, version, operation, before, after)
+    VALUES (NEW.id, NEW.version, operation, previous, snapshot);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+ALTER TABLE todo_history DROP COLUMN IF EXISTS changed_by;
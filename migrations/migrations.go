@@ -0,0 +1,17 @@
+// Package migrations embeds the SQL migrations of the Postgres and SQLite
+// schemas, so that the api binary can apply them without the files on disk.
+package migrations
+
+import "embed"
+
+// FS holds the Postgres migration files, named <version>_<title>.<up|down>.sql
+// as golang-migrate expects.
+//
+//go:embed *.sql
+var FS embed.FS
+
+// SQLite holds the SQLite migration files in its sqlite directory, named like
+// those of FS.
+//
+//go:embed sqlite/*.sql
+var SQLite embed.FS
@@ -0,0 +1,17 @@
+DROP TRIGGER IF EXISTS todos_search_delete;
+DROP TRIGGER IF EXISTS todos_search_update;
+DROP TRIGGER IF EXISTS todos_search_insert;
+DROP TRIGGER IF EXISTS todo_tags_removed;
+DROP TRIGGER IF EXISTS todo_tags_added;
+DROP TRIGGER IF EXISTS todos_updated;
+DROP TRIGGER IF EXISTS todos_created;
+
+DROP TABLE IF EXISTS todos_words;
+DROP TABLE IF EXISTS todos_search;
+DROP VIEW IF EXISTS todo_snapshots;
+DROP TABLE IF EXISTS todo_history;
+DROP TABLE IF EXISTS idempotency_keys;
+DROP TABLE IF EXISTS todo_tags;
+DROP TABLE IF EXISTS tags;
+DROP TABLE IF EXISTS todos;
+DROP TABLE IF EXISTS projects;
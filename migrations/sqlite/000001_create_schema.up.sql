@@ -0,0 +1,191 @@
+-- The schema of the SQLite database, equivalent to the Postgres migrations in
+-- the parent directory. Times are stored as integer microseconds since the
+-- Unix epoch; the current time is written as
+-- CAST(round(unixepoch('subsec') * 1000) AS INTEGER) * 1000.
+CREATE TABLE IF NOT EXISTS projects (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT (CAST(round(unixepoch('subsec') * 1000) AS INTEGER) * 1000)
+);
+
+CREATE TABLE IF NOT EXISTS todos (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    title TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    completed BOOLEAN NOT NULL DEFAULT FALSE,
+    priority INTEGER NOT NULL DEFAULT 0 CONSTRAINT todos_priority_range CHECK (priority BETWEEN 0 AND 4),
+    start_at TIMESTAMP,
+    due_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT (CAST(round(unixepoch('subsec') * 1000) AS INTEGER) * 1000),
+    updated_at TIMESTAMP NOT NULL DEFAULT (CAST(round(unixepoch('subsec') * 1000) AS INTEGER) * 1000),
+    completed_at TIMESTAMP,
+    project_id INTEGER REFERENCES projects (id) ON DELETE SET NULL,
+    parent_id INTEGER REFERENCES todos (id) ON DELETE CASCADE CONSTRAINT todos_parent_not_self CHECK (parent_id <> id),
+    recurrence TEXT NOT NULL DEFAULT '',
+    version INTEGER NOT NULL DEFAULT 1,
+    archived_at TIMESTAMP,
+    deleted_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS todos_due_at_idx ON todos (due_at);
+CREATE INDEX IF NOT EXISTS todos_project_id_idx ON todos (project_id);
+CREATE INDEX IF NOT EXISTS todos_parent_id_idx ON todos (parent_id);
+CREATE INDEX IF NOT EXISTS todos_priority_idx ON todos (priority);
+CREATE INDEX IF NOT EXISTS todos_deleted_at_idx ON todos (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS todos_archived_at_idx ON todos (archived_at) WHERE archived_at IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS tags (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS todo_tags (
+    todo_id INTEGER NOT NULL REFERENCES todos (id) ON DELETE CASCADE,
+    tag_id INTEGER NOT NULL REFERENCES tags (id) ON DELETE CASCADE,
+    PRIMARY KEY (todo_id, tag_id)
+);
+
+CREATE INDEX IF NOT EXISTS todo_tags_tag_id_idx ON todo_tags (tag_id);
+
+-- Responses to requests made with an Idempotency-Key, replayed when a client
+-- retries the same request. A status of 0 marks a request still in progress.
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    key TEXT PRIMARY KEY,
+    request_hash TEXT NOT NULL,
+    status INTEGER NOT NULL DEFAULT 0,
+    header TEXT NOT NULL DEFAULT '{}',
+    body BLOB NOT NULL DEFAULT '',
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
+
+-- Every write of a todo is recorded as a revision with snapshots of the todo,
+-- including its tags, before and after the write.
+CREATE TABLE IF NOT EXISTS todo_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    todo_id INTEGER NOT NULL REFERENCES todos (id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    operation TEXT NOT NULL,
+    changed_at TIMESTAMP NOT NULL DEFAULT (CAST(round(unixepoch('subsec') * 1000) AS INTEGER) * 1000),
+    before TEXT,
+    after TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS todo_history_todo_id_idx ON todo_history (todo_id, id);
+
+-- The JSON snapshot of every todo as stored in todo_history, with the times
+-- formatted as RFC 3339 like to_jsonb does in Postgres.
+CREATE VIEW IF NOT EXISTS todo_snapshots AS
+SELECT t.id, json_object(
+    'id', t.id,
+    'title', t.title,
+    'description', t.description,
+    'completed', json(CASE WHEN t.completed THEN 'true' ELSE 'false' END),
+    'priority', t.priority,
+    'start_at', strftime('%Y-%m-%dT%H:%M:%S', t.start_at / 1000000, 'unixepoch') || printf('.%06dZ', t.start_at % 1000000),
+    'due_at', strftime('%Y-%m-%dT%H:%M:%S', t.due_at / 1000000, 'unixepoch') || printf('.%06dZ', t.due_at % 1000000),
+    'created_at', strftime('%Y-%m-%dT%H:%M:%S', t.created_at / 1000000, 'unixepoch') || printf('.%06dZ', t.created_at % 1000000),
+    'updated_at', strftime('%Y-%m-%dT%H:%M:%S', t.updated_at / 1000000, 'unixepoch') || printf('.%06dZ', t.updated_at % 1000000),
+    'completed_at', strftime('%Y-%m-%dT%H:%M:%S', t.completed_at / 1000000, 'unixepoch') || printf('.%06dZ', t.completed_at % 1000000),
+    'project_id', t.project_id,
+    'parent_id', t.parent_id,
+    'recurrence', t.recurrence,
+    'version', t.version,
+    'archived_at', strftime('%Y-%m-%dT%H:%M:%S', t.archived_at / 1000000, 'unixepoch') || printf('.%06dZ', t.archived_at % 1000000),
+    'deleted_at', strftime('%Y-%m-%dT%H:%M:%S', t.deleted_at / 1000000, 'unixepoch') || printf('.%06dZ', t.deleted_at % 1000000),
+    'tags', json((
+        SELECT json_group_array(g.name ORDER BY g.name)
+        FROM todo_tags tt JOIN tags g ON g.id = tt.tag_id
+        WHERE tt.todo_id = t.id
+    ))
+) AS snapshot
+FROM todos t;
+
+-- Sets completed_at of todos created completed and records their creation.
+CREATE TRIGGER IF NOT EXISTS todos_created AFTER INSERT ON todos
+BEGIN
+    UPDATE todos SET completed_at = created_at WHERE id = NEW.id AND completed;
+
+    INSERT INTO todo_history (todo_id, version, operation, after)
+    SELECT id, 1, 'create', snapshot FROM todo_snapshots WHERE id = NEW.id;
+END;
+
+-- Keeps the audit timestamps and the version in sync no matter which client
+-- writes the row, unarchives reopened todos and records the write. The
+-- version, created_at and completed_at are maintained here only, so writing
+-- them does not run the trigger again.
+CREATE TRIGGER IF NOT EXISTS todos_updated
+    AFTER UPDATE OF title, description, completed, priority, start_at, due_at, updated_at,
+        project_id, parent_id, recurrence, archived_at, deleted_at ON todos
+    WHEN NEW.version = OLD.version
+BEGIN
+    UPDATE todos SET
+        version = OLD.version + 1,
+        created_at = OLD.created_at,
+        updated_at = CAST(round(unixepoch('subsec') * 1000) AS INTEGER) * 1000,
+        completed_at = CASE
+            WHEN NOT NEW.completed THEN NULL
+            WHEN NOT OLD.completed THEN CAST(round(unixepoch('subsec') * 1000) AS INTEGER) * 1000
+            ELSE OLD.completed_at
+        END,
+        archived_at = CASE WHEN NEW.completed THEN NEW.archived_at END
+    WHERE id = NEW.id;
+
+    INSERT INTO todo_history (todo_id, version, operation, before, after)
+    SELECT s.id, OLD.version + 1,
+        CASE
+            WHEN OLD.deleted_at IS NULL AND NEW.deleted_at IS NOT NULL THEN 'delete'
+            WHEN OLD.deleted_at IS NOT NULL AND NEW.deleted_at IS NULL THEN 'restore'
+            ELSE 'update'
+        END,
+        (SELECT h.after FROM todo_history h WHERE h.todo_id = NEW.id ORDER BY h.id DESC LIMIT 1),
+        s.snapshot
+    FROM todo_snapshots s WHERE s.id = NEW.id;
+END;
+
+-- The tags of a todo are written after the todo itself, so they are added to
+-- the snapshot of the revision recorded for that write.
+CREATE TRIGGER IF NOT EXISTS todo_tags_added AFTER INSERT ON todo_tags
+BEGIN
+    UPDATE todo_history SET after = (SELECT snapshot FROM todo_snapshots WHERE id = NEW.todo_id)
+    WHERE id = (SELECT max(id) FROM todo_history WHERE todo_id = NEW.todo_id);
+END;
+
+CREATE TRIGGER IF NOT EXISTS todo_tags_removed AFTER DELETE ON todo_tags
+BEGIN
+    UPDATE todo_history SET after = (SELECT snapshot FROM todo_snapshots WHERE id = OLD.todo_id)
+    WHERE id = (SELECT max(id) FROM todo_history WHERE todo_id = OLD.todo_id);
+END;
+
+-- Full-text indexes of the titles and descriptions, kept in sync with todos:
+-- todos_search holds stemmed words and todos_words the words as written, for
+-- prefix searches, since the prefix would be stemmed as well.
+CREATE VIRTUAL TABLE IF NOT EXISTS todos_search USING fts5(
+    title, description, content = 'todos', content_rowid = 'id', tokenize = 'porter unicode61'
+);
+
+CREATE VIRTUAL TABLE IF NOT EXISTS todos_words USING fts5(
+    title, description, content = 'todos', content_rowid = 'id', tokenize = 'unicode61'
+);
+
+CREATE TRIGGER IF NOT EXISTS todos_search_insert AFTER INSERT ON todos
+BEGIN
+    INSERT INTO todos_search (rowid, title, description) VALUES (NEW.id, NEW.title, NEW.description);
+    INSERT INTO todos_words (rowid, title, description) VALUES (NEW.id, NEW.title, NEW.description);
+END;
+
+CREATE TRIGGER IF NOT EXISTS todos_search_update AFTER UPDATE OF title, description ON todos
+BEGIN
+    INSERT INTO todos_search (todos_search, rowid, title, description) VALUES ('delete', OLD.id, OLD.title, OLD.description);
+    INSERT INTO todos_search (rowid, title, description) VALUES (NEW.id, NEW.title, NEW.description);
+    INSERT INTO todos_words (todos_words, rowid, title, description) VALUES ('delete', OLD.id, OLD.title, OLD.description);
+    INSERT INTO todos_words (rowid, title, description) VALUES (NEW.id, NEW.title, NEW.description);
+END;
+
+CREATE TRIGGER IF NOT EXISTS todos_search_delete AFTER DELETE ON todos
+BEGIN
+    INSERT INTO todos_search (todos_search, rowid, title, description) VALUES ('delete', OLD.id, OLD.title, OLD.description);
+    INSERT INTO todos_words (todos_words, rowid, title, description) VALUES ('delete', OLD.id, OLD.title, OLD.description);
+END;
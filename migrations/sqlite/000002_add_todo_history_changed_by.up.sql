@@ -0,0 +1,50 @@
+-- Records who made every write. Triggers cannot read connection settings, so
+-- every transaction first stores its actor in todo_history_actor, which has a
+-- single row.
+ALTER TABLE todo_history ADD COLUMN changed_by TEXT;
+
+CREATE TABLE IF NOT EXISTS todo_history_actor (
+    actor TEXT
+);
+
+INSERT INTO todo_history_actor (actor) SELECT NULL WHERE NOT EXISTS (SELECT 1 FROM todo_history_actor);
+
+DROP TRIGGER IF EXISTS todos_created;
+CREATE TRIGGER todos_created AFTER INSERT ON todos
+BEGIN
+    UPDATE todos SET completed_at = created_at WHERE id = NEW.id AND completed;
+
+    INSERT INTO todo_history (todo_id, version, operation, changed_by, after)
+    SELECT id, 1, 'create', (SELECT actor FROM todo_history_actor), snapshot FROM todo_snapshots WHERE id = NEW.id;
+END;
+
+DROP TRIGGER IF EXISTS todos_updated;
+CREATE TRIGGER todos_updated
+    AFTER UPDATE OF title, description, completed, priority, start_at, due_at, updated_at,
+        project_id, parent_id, recurrence, archived_at, deleted_at ON todos
+    WHEN NEW.version = OLD.version
+BEGIN
+    UPDATE todos SET
+        version = OLD.version + 1,
+        created_at = OLD.created_at,
+        updated_at = CAST(round(unixepoch('subsec') * 1000) AS INTEGER) * 1000,
+        completed_at = CASE
+            WHEN NOT NEW.completed THEN NULL
+            WHEN NOT OLD.completed THEN CAST(round(unixepoch('subsec') * 1000) AS INTEGER) * 1000
+            ELSE OLD.completed_at
+        END,
+        archived_at = CASE WHEN NEW.completed THEN NEW.archived_at END
+    WHERE id = NEW.id;
+
+    INSERT INTO todo_history (todo_id, version, operation, changed_by, before, after)
+    SELECT s.id, OLD.version + 1,
+        CASE
+            WHEN OLD.deleted_at IS NULL AND NEW.deleted_at IS NOT NULL THEN 'delete'
+            WHEN OLD.deleted_at IS NOT NULL AND NEW.deleted_at IS NULL THEN 'restore'
+            ELSE 'update'
+        END,
+        (SELECT actor FROM todo_history_actor),
+        (SELECT h.after FROM todo_history h WHERE h.todo_id = NEW.id ORDER BY h.id DESC LIMIT 1),
+        s.snapshot
+    FROM todo_snapshots s WHERE s.id = NEW.id;
+END;
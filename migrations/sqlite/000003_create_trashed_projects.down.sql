@@ -0,0 +1,3 @@
+ALTER TABLE todos DROP COLUMN trashed_project_id;
+
+DROP TABLE IF EXISTS trashed_projects;
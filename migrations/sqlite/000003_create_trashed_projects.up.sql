@@ -0,0 +1,12 @@
+-- Projects deleted together with their todos are kept here while any of the
+-- todos is in the trash, so that restoring one brings the project back. The
+-- todos remember their project in trashed_project_id, as project_id has to
+-- reference an existing project.
+CREATE TABLE IF NOT EXISTS trashed_projects (
+    id INTEGER PRIMARY KEY,
+    name TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL
+);
+
+ALTER TABLE todos ADD COLUMN trashed_project_id INTEGER;